@@ -0,0 +1,35 @@
+package extension
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+type ctxOldObject struct{}
+
+// key must be comparable and should not be of type string
+var ctxOldObjectKey = &ctxOldObject{}
+
+// withOldObject returns a context carrying the object as it was before the request
+func withOldObject(ctx context.Context, obj runtime.Object) context.Context {
+	return context.WithValue(ctx, ctxOldObjectKey, obj)
+}
+
+// OldObjectFromContext returns the object as it was before the admission request.
+// It is set on the context passed to the Extensions and the Validators for UPDATE requests only.
+func OldObjectFromContext(ctx context.Context) (runtime.Object, bool) {
+	obj, ok := ctx.Value(ctxOldObjectKey).(runtime.Object)
+	return obj, ok && obj != nil
+}
+
+// OldPodFromContext returns the pod as it was before the admission request, see OldObjectFromContext.
+func OldPodFromContext(ctx context.Context) (*corev1.Pod, bool) {
+	obj, ok := OldObjectFromContext(ctx)
+	if !ok {
+		return nil, false
+	}
+	pod, ok := obj.(*corev1.Pod)
+	return pod, ok
+}
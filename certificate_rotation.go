@@ -0,0 +1,179 @@
+package extension
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	machinerytypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
+
+	"code.cloudfoundry.org/eirinix/util/ctxlog"
+)
+
+const (
+	// DefaultCertificateRenewBefore is the time before their expiry when the webhook certificates are regenerated
+	DefaultCertificateRenewBefore = 30 * 24 * time.Hour
+
+	// DefaultCertificateCheckInterval is the interval between two checks of the webhook certificates expiry
+	DefaultCertificateCheckInterval = time.Hour
+)
+
+// checkCertificate returns an error if the certificates must be regenerated: if they can't be parsed,
+// expire within RenewBefore, or don't match the SubjectAltNames of the webhook server.
+func (f *WebhookConfig) checkCertificate(now time.Time) error {
+	if err := f.checkExpiry(now); err != nil {
+		return err
+	}
+	return f.checkSubjectAltNames()
+}
+
+// checkExpiry returns an error if the CA or the certificate can't be parsed, or expire within RenewBefore
+func (f *WebhookConfig) checkExpiry(now time.Time) error {
+	renewBefore := f.RenewBefore
+	if renewBefore == 0 {
+		renewBefore = DefaultCertificateRenewBefore
+	}
+
+	names := []string{"CA", "certificate"}
+	for i, certificate := range [][]byte{f.CaCertificate, f.Certificate} {
+		cert, err := parseCertificate(certificate)
+		if err != nil {
+			return errors.Wrapf(err, "parsing the %s", names[i])
+		}
+		if now.Add(renewBefore).After(cert.NotAfter) {
+			return fmt.Errorf("the %s expires on %s", names[i], cert.NotAfter.Format(time.RFC3339))
+		}
+	}
+	return nil
+}
+
+// checkSubjectAltNames returns an error if the SubjectAltNames of the certificate differ from the wanted ones
+func (f *WebhookConfig) checkSubjectAltNames() error {
+	cert, err := parseCertificate(f.Certificate)
+	if err != nil {
+		return errors.Wrap(err, "parsing the certificate")
+	}
+
+	actual := map[string]bool{}
+	for _, name := range cert.DNSNames {
+		actual[name] = true
+	}
+	for _, ip := range cert.IPAddresses {
+		actual[ip.String()] = true
+	}
+
+	// The generator adds the CommonName to the SubjectAltNames
+	wanted := map[string]bool{}
+	for _, name := range f.subjectAltNames() {
+		wanted[name] = true
+	}
+	if cn := f.commonName(); cn != "" {
+		wanted[cn] = true
+	}
+
+	if !reflect.DeepEqual(actual, wanted) {
+		return fmt.Errorf("the certificate is issued for %v instead of %v", sortedKeys(actual), sortedKeys(wanted))
+	}
+	return nil
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// parseCertificate parses a PEM encoded certificate
+func parseCertificate(certificate []byte) (*x509.Certificate, error) {
+	block, _ := pem.Decode(certificate)
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+// caBundle returns the CAs the API server uses to verify the webhook server
+func (f *WebhookConfig) caBundle() []byte {
+	if len(f.previousCaCertificate) == 0 {
+		return f.CaCertificate
+	}
+	bundle := append([]byte{}, f.CaCertificate...)
+	if len(bundle) > 0 && bundle[len(bundle)-1] != '\n' {
+		bundle = append(bundle, '\n')
+	}
+	return append(bundle, f.previousCaCertificate...)
+}
+
+// renewCertificate reloads the certificates from the Secret, which regenerates them if they are about to expire.
+// It returns true if the certificates changed, e.g. renewed by this or by another replica.
+func (f *WebhookConfig) renewCertificate(ctx context.Context) (bool, error) {
+	cert := f.Certificate
+	if err := f.ensureCertificate(ctx); err != nil {
+		return false, err
+	}
+	f.observeCertificateExpiry()
+
+	return !bytes.Equal(cert, f.Certificate), nil
+}
+
+// updateCABundle sets the CA bundle of the webhooks of the operator in the named configuration, leaving the
+// webhooks of other operators untouched. Configurations which don't exist are skipped, and conflicting
+// writes are retried.
+func (f *WebhookConfig) updateCABundle(ctx context.Context, kind string, name string) error {
+	caBundle := base64.StdEncoding.EncodeToString(f.caBundle())
+	updated := false
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		config := &unstructured.Unstructured{}
+		config.SetGroupVersionKind(f.configurationGroupVersionKind(kind))
+		err := f.client.Get(ctx, machinerytypes.NamespacedName{Name: name}, config)
+		if k8serrors.IsNotFound(err) {
+			return nil
+		}
+		if err != nil {
+			return errors.Wrapf(err, "getting the %s %s", kind, name)
+		}
+
+		webhooks, _, err := unstructured.NestedSlice(config.Object, "webhooks")
+		if err != nil {
+			return errors.Wrapf(err, "reading the webhooks of the %s %s", kind, name)
+		}
+		for i := range webhooks {
+			webhook, ok := webhooks[i].(map[string]interface{})
+			if !ok || !f.ownWebhook(fmt.Sprint(webhook["name"]), nil) {
+				continue
+			}
+			if err := unstructured.SetNestedField(webhook, caBundle, "clientConfig", "caBundle"); err != nil {
+				return err
+			}
+		}
+		if err := unstructured.SetNestedSlice(config.Object, webhooks, "webhooks"); err != nil {
+			return err
+		}
+
+		if err := f.client.Update(ctx, config); err != nil {
+			return err
+		}
+		updated = true
+		return nil
+	})
+	if err != nil {
+		return errors.Wrapf(err, "updating the CA bundle of the %s %s", kind, name)
+	}
+	if updated {
+		ctxlog.Infof(ctx, "Updated the CA bundle of the %s %s", kind, name)
+	}
+	return nil
+}
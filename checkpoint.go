@@ -0,0 +1,372 @@
+package extension
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/afero"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/util/retry"
+)
+
+// DefaultCheckpointInterval is the interval between two saves of the checkpoints if no CheckpointInterval is given
+const DefaultCheckpointInterval = 10 * time.Second
+
+// CheckpointStore persists the ResourceVersion each watch got to, so that the watches resume from it
+// after a restart instead of starting from the current ResourceVersion, see ManagerOptions.CheckpointStore.
+type CheckpointStore interface {
+	// Load returns the ResourceVersion saved for the watch, or an empty string if there is none
+	Load(key string) (string, error)
+
+	// Save saves the ResourceVersion of the watch
+	Save(key string, resourceVersion string) error
+}
+
+// kubeClientInjectable is implemented by the CheckpointStores using the kube client of the Manager
+type kubeClientInjectable interface {
+	injectKubeClient(corev1client.CoreV1Interface)
+}
+
+// ConfigMapCheckpointStore is a CheckpointStore keeping the ResourceVersions in the data of a ConfigMap,
+// which is created if it doesn't exist.
+type ConfigMapCheckpointStore struct {
+	Namespace string
+	Name      string
+
+	client corev1client.ConfigMapsGetter
+}
+
+// NewConfigMapCheckpointStore returns a CheckpointStore keeping the ResourceVersions in the given ConfigMap.
+// It uses the kube client of the Manager.
+func NewConfigMapCheckpointStore(namespace, name string) *ConfigMapCheckpointStore {
+	return &ConfigMapCheckpointStore{Namespace: namespace, Name: name}
+}
+
+func (s *ConfigMapCheckpointStore) injectKubeClient(client corev1client.CoreV1Interface) {
+	if s.client == nil {
+		s.client = client
+	}
+}
+
+// Load returns the ResourceVersion saved for the watch in the ConfigMap
+func (s *ConfigMapCheckpointStore) Load(key string) (string, error) {
+	configMap, err := s.client.ConfigMaps(s.Namespace).Get(context.Background(), s.Name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", errors.Wrapf(err, "getting the checkpoints config map %s/%s", s.Namespace, s.Name)
+	}
+	return configMap.Data[key], nil
+}
+
+// Save saves the ResourceVersion of the watch in the ConfigMap
+func (s *ConfigMapCheckpointStore) Save(key string, resourceVersion string) error {
+	configMaps := s.client.ConfigMaps(s.Namespace)
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		configMap, err := configMaps.Get(context.Background(), s.Name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			_, err = configMaps.Create(context.Background(), &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: s.Name, Namespace: s.Namespace},
+				Data:       map[string]string{key: resourceVersion},
+			}, metav1.CreateOptions{})
+			return err
+		}
+		if err != nil {
+			return err
+		}
+		if configMap.Data == nil {
+			configMap.Data = map[string]string{}
+		}
+		configMap.Data[key] = resourceVersion
+		_, err = configMaps.Update(context.Background(), configMap, metav1.UpdateOptions{})
+		return err
+	})
+	return errors.Wrapf(err, "saving the checkpoint in the config map %s/%s", s.Namespace, s.Name)
+}
+
+// FileCheckpointStore is a CheckpointStore keeping the ResourceVersions in a JSON file, e.g. on a persistent volume
+type FileCheckpointStore struct {
+	Fs   afero.Fs
+	Path string
+
+	mutex sync.Mutex
+}
+
+// NewFileCheckpointStore returns a CheckpointStore keeping the ResourceVersions in the file at path
+func NewFileCheckpointStore(path string) *FileCheckpointStore {
+	return &FileCheckpointStore{Fs: afero.NewOsFs(), Path: path}
+}
+
+// read returns the ResourceVersions saved in the file
+func (s *FileCheckpointStore) read() (map[string]string, error) {
+	checkpoints := map[string]string{}
+	data, err := afero.ReadFile(s.Fs, s.Path)
+	if os.IsNotExist(err) {
+		return checkpoints, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading the checkpoints file %s", s.Path)
+	}
+	if err := json.Unmarshal(data, &checkpoints); err != nil {
+		return nil, errors.Wrapf(err, "parsing the checkpoints file %s", s.Path)
+	}
+	return checkpoints, nil
+}
+
+// Load returns the ResourceVersion saved for the watch in the file
+func (s *FileCheckpointStore) Load(key string) (string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	checkpoints, err := s.read()
+	if err != nil {
+		return "", err
+	}
+	return checkpoints[key], nil
+}
+
+// Save saves the ResourceVersion of the watch in the file, replacing it atomically
+func (s *FileCheckpointStore) Save(key string, resourceVersion string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	checkpoints, err := s.read()
+	if err != nil {
+		return err
+	}
+	checkpoints[key] = resourceVersion
+	data, err := json.Marshal(checkpoints)
+	if err != nil {
+		return err
+	}
+
+	if err := s.Fs.MkdirAll(filepath.Dir(s.Path), 0750); err != nil {
+		return errors.Wrapf(err, "creating the directory of the checkpoints file %s", s.Path)
+	}
+	tmp := s.Path + ".tmp"
+	if err := afero.WriteFile(s.Fs, tmp, data, 0640); err != nil {
+		return errors.Wrapf(err, "writing the checkpoints file %s", tmp)
+	}
+	return errors.Wrapf(s.Fs.Rename(tmp, s.Path), "renaming the checkpoints file %s", tmp)
+}
+
+// checkpointKey returns the key of the checkpoint of the watch
+func (k watchKey) checkpointKey() string {
+	key := k.resource.GroupResource().String()
+	if k.labelSelector == "" && k.fieldSelector == "" {
+		return key
+	}
+	hash := fnv.New32a()
+	hash.Write([]byte(k.labelSelector + "?" + k.fieldSelector))
+	return fmt.Sprintf("%s-%x", key, hash.Sum32())
+}
+
+// watchCheckpoint tracks the ResourceVersion a watch got to, i.e. of the last event which the watchers handled
+// after the ones before it. Its methods do nothing on a nil checkpoint, when the watch isn't checkpointed.
+type watchCheckpoint struct {
+	key string
+
+	mutex           sync.Mutex
+	resourceVersion string
+	events          []*trackedEvent
+	saved           string
+}
+
+// trackedEvent is an event of a checkpointed watch, or a bookmark, whose watchers are handling it
+type trackedEvent struct {
+	checkpoint      *watchCheckpoint
+	resourceVersion string
+	// dispatched tells the event was read from the watch, the events lost on the way are received again
+	dispatched bool
+	// pending is the number of watchers handling the event, plus one until it's dispatched to all of them
+	pending int
+}
+
+// track returns a watch recording the events of w, in their order, including the bookmarks
+// which the retry watchers don't pass on
+func (c *watchCheckpoint) track(w watch.Interface) watch.Interface {
+	if c == nil {
+		return w
+	}
+	return watch.Filter(w, func(e watch.Event) (watch.Event, bool) {
+		c.add(e)
+		return e, true
+	})
+}
+
+// add records the ResourceVersion of the event, which the checkpoint gets to once it's handled
+func (c *watchCheckpoint) add(e watch.Event) {
+	object, err := meta.Accessor(e.Object)
+	if e.Type == watch.Error || err != nil || object.GetResourceVersion() == "" {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	bookmark := e.Type == watch.Bookmark
+	t := &trackedEvent{checkpoint: c, resourceVersion: object.GetResourceVersion(), dispatched: bookmark, pending: 1}
+	if bookmark {
+		t.pending = 0
+	}
+	c.events = append(c.events, t)
+	c.advance()
+}
+
+// dispatch returns the tracked event read from the watch, which the caller marks as handled once it's
+// passed to the watchers. It returns nil if the event isn't tracked.
+func (c *watchCheckpoint) dispatch(e watch.Event) *trackedEvent {
+	if c == nil {
+		return nil
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if e.Type == watch.Error {
+		// The ResourceVersion is too old, the watch is started again from the current one
+		if err := apierrors.FromObject(e.Object); apierrors.IsGone(err) || apierrors.IsResourceExpired(err) {
+			c.resourceVersion = ""
+			c.events = nil
+		}
+		return nil
+	}
+	object, err := meta.Accessor(e.Object)
+	if err != nil {
+		return nil
+	}
+	for i := 0; i < len(c.events); i++ {
+		t := c.events[i]
+		if t.dispatched {
+			continue
+		}
+		if t.resourceVersion == object.GetResourceVersion() {
+			t.dispatched = true
+			return t
+		}
+		// The event was lost by a previous watch, and the current one received it again
+		c.events = append(c.events[:i], c.events[i+1:]...)
+		i--
+	}
+	return nil
+}
+
+// advance moves the checkpoint to the last of the first events which were handled
+func (c *watchCheckpoint) advance() {
+	for len(c.events) > 0 && c.events[0].dispatched && c.events[0].pending == 0 {
+		c.resourceVersion = c.events[0].resourceVersion
+		c.events = c.events[1:]
+	}
+}
+
+// handling records that one more watcher handles the event
+func (t *trackedEvent) handling() {
+	if t == nil {
+		return
+	}
+	t.checkpoint.mutex.Lock()
+	defer t.checkpoint.mutex.Unlock()
+	t.pending++
+}
+
+// handled records that a watcher handled the event, or dropped it
+func (t *trackedEvent) handled() {
+	if t == nil {
+		return
+	}
+	t.checkpoint.mutex.Lock()
+	defer t.checkpoint.mutex.Unlock()
+	t.pending--
+	t.checkpoint.advance()
+}
+
+// resume returns the ResourceVersion to start the watch from, or an empty string to start from the current one.
+// The watch resumes after the events which are dispatched, but not handled yet.
+func (c *watchCheckpoint) resume() string {
+	if c == nil {
+		return ""
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for i, t := range c.events {
+		if !t.dispatched {
+			c.events = c.events[:i]
+			break
+		}
+	}
+	if len(c.events) > 0 {
+		return c.events[len(c.events)-1].resourceVersion
+	}
+	return c.resourceVersion
+}
+
+// save saves the ResourceVersion in the store, if it changed since the last save
+func (c *watchCheckpoint) save(store CheckpointStore) error {
+	c.mutex.Lock()
+	resourceVersion := c.resourceVersion
+	c.mutex.Unlock()
+	if resourceVersion == "" || resourceVersion == c.saved {
+		return nil
+	}
+	if err := store.Save(c.key, resourceVersion); err != nil {
+		return err
+	}
+	c.saved = resourceVersion
+	return nil
+}
+
+// loadCheckpoint returns the checkpoint of the watch, resuming from the ResourceVersion in the CheckpointStore.
+// It returns nil if no CheckpointStore is set.
+func (m *DefaultExtensionManager) loadCheckpoint(key string) *watchCheckpoint {
+	store := m.Options.CheckpointStore
+	if store == nil {
+		return nil
+	}
+	if injectable, ok := store.(kubeClientInjectable); ok {
+		if client, err := m.GetKubeClient(); err == nil {
+			injectable.injectKubeClient(client)
+		}
+	}
+
+	resourceVersion, err := store.Load(key)
+	if err != nil {
+		m.Logger.Warnf("Failed loading the checkpoint of the %s watch, watching from now on: %s", key, err.Error())
+	}
+	return &watchCheckpoint{key: key, resourceVersion: resourceVersion, saved: resourceVersion}
+}
+
+// saveCheckpoints saves the checkpoints every CheckpointInterval, and once more when stop is closed
+func (m *DefaultExtensionManager) saveCheckpoints(stop <-chan struct{}, checkpoints []*watchCheckpoint) {
+	interval := m.Options.CheckpointInterval
+	if interval <= 0 {
+		interval = DefaultCheckpointInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	save := func() {
+		for _, c := range checkpoints {
+			if err := c.save(m.Options.CheckpointStore); err != nil {
+				m.Logger.Errorf("Failed saving the checkpoint of the %s watch: %s", c.key, err.Error())
+			}
+		}
+	}
+	for {
+		select {
+		case <-stop:
+			save()
+			return
+		case <-ticker.C:
+			save()
+		}
+	}
+}
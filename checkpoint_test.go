@@ -0,0 +1,246 @@
+package extension_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	. "code.cloudfoundry.org/eirinix"
+	catalog "code.cloudfoundry.org/eirinix/testing"
+	cfakes "code.cloudfoundry.org/eirinix/testing/fakes"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/spf13/afero"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/kubernetes/scheme"
+	restfake "k8s.io/client-go/rest/fake"
+)
+
+var _ = Describe("Watch checkpoints", func() {
+	Context("with a file", func() {
+		It("saves the ResourceVersions of the watches", func() {
+			fs := afero.NewMemMapFs()
+			store := &FileCheckpointStore{Fs: fs, Path: "/var/lib/eirinix/checkpoints.json"}
+
+			rv, err := store.Load("pods")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rv).To(BeEmpty())
+
+			Expect(store.Save("pods", "12")).To(Succeed())
+			Expect(store.Save("statefulsets.apps", "7")).To(Succeed())
+			Expect(store.Save("pods", "13")).To(Succeed())
+
+			store = &FileCheckpointStore{Fs: fs, Path: "/var/lib/eirinix/checkpoints.json"}
+			Expect(store.Load("pods")).To(Equal("13"))
+			Expect(store.Load("statefulsets.apps")).To(Equal("7"))
+		})
+
+		It("fails loading a corrupted file", func() {
+			fs := afero.NewMemMapFs()
+			Expect(afero.WriteFile(fs, "checkpoints.json", []byte("{"), 0640)).To(Succeed())
+			store := &FileCheckpointStore{Fs: fs, Path: "checkpoints.json"}
+
+			_, err := store.Load("pods")
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("parsing the checkpoints file checkpoints.json"))
+		})
+	})
+
+	Context("when running the pod watchers", func() {
+		var (
+			eirinixcatalog catalog.Catalog
+			eiriniManager  *DefaultExtensionManager
+			clientset      *fake.Clientset
+			lists          int32
+			watchOptions   chan metav1.ListOptions
+			podWatches     chan *watch.FakeWatcher
+			events         chan watch.Event
+			stop           chan struct{}
+			done           chan error
+		)
+
+		BeforeEach(func() {
+			eirinixcatalog = catalog.NewCatalog()
+			eiriniManager = eirinixcatalog.SimpleManager().(*DefaultExtensionManager)
+			eiriniManager.Options.CheckpointInterval = time.Hour
+
+			watchOptions = make(chan metav1.ListOptions, 10)
+			podWatches = make(chan *watch.FakeWatcher, 10)
+			fakeCorev1 := &cfakes.FakeCoreV1Interface{}
+			fakePod := &cfakes.FakePodInterface{}
+			fakePod.WatchCalls(func(_ context.Context, options metav1.ListOptions) (watch.Interface, error) {
+				watchOptions <- options
+				w := watch.NewFake()
+				podWatches <- w
+				return w, nil
+			})
+			fakeCorev1.PodsReturns(fakePod)
+			lists = 0
+			fakeCorev1.RESTClientReturns(&restfake.RESTClient{
+				NegotiatedSerializer: scheme.Codecs.WithoutConversion(),
+				Client: restfake.CreateHTTPClient(func(*http.Request) (*http.Response, error) {
+					atomic.AddInt32(&lists, 1)
+					list := `{"kind":"PodList","apiVersion":"v1","metadata":{"resourceVersion":"20"},"items":[]}`
+					return &http.Response{
+						StatusCode: http.StatusOK,
+						Header:     http.Header{"Content-Type": []string{runtime.ContentTypeJSON}},
+						Body:       ioutil.NopCloser(strings.NewReader(list)),
+					}, nil
+				}),
+			})
+			clientset = fake.NewSimpleClientset()
+			fakeCorev1.ConfigMapsCalls(clientset.CoreV1().ConfigMaps)
+			eiriniManager.SetKubeClient(fakeCorev1)
+
+			events = make(chan watch.Event, 10)
+			eiriniManager.AddWatcher(eirinixcatalog.SimpleWatcherWithChannel(events))
+			stop = make(chan struct{})
+			done = make(chan error)
+		})
+
+		run := func() {
+			go func() {
+				done <- eiriniManager.RunWatchers(stop)
+			}()
+		}
+
+		pod := func(name, resourceVersion string) *corev1.Pod {
+			return &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: name, ResourceVersion: resourceVersion}}
+		}
+
+		It("resumes from the saved ResourceVersion and saves the one it got to on stop", func() {
+			_, err := clientset.CoreV1().ConfigMaps("eirini").Create(context.Background(), &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: "eirinix-checkpoints", Namespace: "eirini"},
+				Data:       map[string]string{"pods": "5"},
+			}, metav1.CreateOptions{})
+			Expect(err).ToNot(HaveOccurred())
+			eiriniManager.Options.CheckpointStore = NewConfigMapCheckpointStore("eirini", "eirinix-checkpoints")
+			eiriniManager.Options.WatcherStartRV = "1"
+			run()
+
+			var options metav1.ListOptions
+			Eventually(watchOptions, 5*time.Second).Should(Receive(&options))
+			Expect(options.ResourceVersion).To(Equal("5"))
+			Expect(options.AllowWatchBookmarks).To(BeTrue())
+			Expect(atomic.LoadInt32(&lists)).To(BeZero())
+
+			var podWatch *watch.FakeWatcher
+			Eventually(podWatches, 5*time.Second).Should(Receive(&podWatch))
+			podWatch.Add(pod("foo", "6"))
+			Eventually(events, 5*time.Second).Should(Receive())
+			podWatch.Action(watch.Bookmark, pod("", "8"))
+			// The bookmarks aren't passed to the watchers, the next event tells the bookmark was read
+			podWatch.Modify(pod("foo", "9"))
+			Eventually(events, 5*time.Second).Should(Receive())
+
+			close(stop)
+			Eventually(done, 5*time.Second).Should(Receive(BeNil()))
+			configMap, err := clientset.CoreV1().ConfigMaps("eirini").Get(context.Background(), "eirinix-checkpoints", metav1.GetOptions{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(configMap.Data).To(Equal(map[string]string{"pods": "9"}))
+		})
+
+		It("starts from WatcherStartRV without a checkpoint and creates the config map", func() {
+			eiriniManager.Options.CheckpointStore = NewConfigMapCheckpointStore("eirini", "eirinix-checkpoints")
+			eiriniManager.Options.WatcherStartRV = "3"
+			run()
+
+			var options metav1.ListOptions
+			Eventually(watchOptions, 5*time.Second).Should(Receive(&options))
+			Expect(options.ResourceVersion).To(Equal("3"))
+			var podWatch *watch.FakeWatcher
+			Eventually(podWatches, 5*time.Second).Should(Receive(&podWatch))
+			podWatch.Add(pod("foo", "4"))
+			Eventually(events, 5*time.Second).Should(Receive())
+
+			close(stop)
+			Eventually(done, 5*time.Second).Should(Receive(BeNil()))
+			configMap, err := clientset.CoreV1().ConfigMaps("eirini").Get(context.Background(), "eirinix-checkpoints", metav1.GetOptions{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(configMap.Data).To(Equal(map[string]string{"pods": "4"}))
+		})
+
+		It("saves the ResourceVersion of an event once the watchers handled it", func() {
+			store := &FileCheckpointStore{Fs: afero.NewMemMapFs(), Path: "checkpoints.json"}
+			Expect(store.Save("pods", "5")).To(Succeed())
+			eiriniManager.Options.CheckpointStore = store
+			eiriniManager.Options.CheckpointInterval = 10 * time.Millisecond
+			eiriniManager.Options.WatcherQueue = &WatcherQueueOptions{}
+			handled := make(chan watch.Event)
+			eiriniManager.AddWatcher(eirinixcatalog.SimpleWatcherWithChannel(handled))
+			run()
+
+			var podWatch *watch.FakeWatcher
+			Eventually(podWatches, 5*time.Second).Should(Receive(&podWatch))
+			podWatch.Add(pod("foo", "6"))
+			Eventually(events, 5*time.Second).Should(Receive())
+			load := func() (string, error) { return store.Load("pods") }
+			Consistently(load, 200*time.Millisecond).Should(Equal("5"))
+
+			Eventually(handled, 5*time.Second).Should(Receive())
+			Eventually(load, 5*time.Second).Should(Equal("6"))
+
+			close(stop)
+			Eventually(done, 5*time.Second).Should(Receive(BeNil()))
+		})
+
+		It("relists when the saved ResourceVersion is too old", func() {
+			store := &FileCheckpointStore{Fs: afero.NewMemMapFs(), Path: "checkpoints.json"}
+			Expect(store.Save("pods", "5")).To(Succeed())
+			eiriniManager.Options.CheckpointStore = store
+			run()
+
+			var options metav1.ListOptions
+			Eventually(watchOptions, 5*time.Second).Should(Receive(&options))
+			Expect(options.ResourceVersion).To(Equal("5"))
+			var podWatch *watch.FakeWatcher
+			Eventually(podWatches, 5*time.Second).Should(Receive(&podWatch))
+			podWatch.Error(&apierrors.NewResourceExpired("too old resource version: 5 (15)").ErrStatus)
+			var e watch.Event
+			Eventually(events, 5*time.Second).Should(Receive(&e))
+			Expect(e.Type).To(Equal(watch.Error))
+
+			Eventually(watchOptions, 5*time.Second).Should(Receive(&options))
+			Expect(options.ResourceVersion).To(Equal("20"))
+			Expect(atomic.LoadInt32(&lists)).To(Equal(int32(1)))
+
+			close(stop)
+			Eventually(done, 5*time.Second).Should(Receive(BeNil()))
+		})
+	})
+
+	It("grants the access to the checkpoints config map", func() {
+		eirinixcatalog := catalog.NewCatalog()
+		eiriniManager := eirinixcatalog.SimpleManager().(*DefaultExtensionManager)
+		eiriniManager.Options.CheckpointStore = NewConfigMapCheckpointStore("eirinix", "eirinix-checkpoints")
+
+		objects, err := eiriniManager.Manifests()
+		Expect(err).ToNot(HaveOccurred())
+		var rules []rbacv1.PolicyRule
+		for _, o := range objects {
+			if role, ok := o.(*rbacv1.Role); ok && role.Namespace == "eirinix" {
+				rules = append(rules, role.Rules...)
+			}
+		}
+		Expect(rules).To(ContainElement(rbacv1.PolicyRule{
+			APIGroups:     []string{""},
+			Resources:     []string{"configmaps"},
+			ResourceNames: []string{"eirinix-checkpoints"},
+			Verbs:         []string{"get", "update"},
+		}))
+		Expect(rules).To(ContainElement(rbacv1.PolicyRule{
+			APIGroups: []string{""},
+			Resources: []string{"configmaps"},
+			Verbs:     []string{"create"},
+		}))
+	})
+})
@@ -0,0 +1,52 @@
+// Command example renders the manifests of an extension without connecting to the cluster.
+//
+// It is meant to be copied along with the extensions, registering them with the ManagerOptions they run with:
+//
+//	go run ./cmd/render/example -namespace eirini -webhook-namespace cf -service-account extensions -o manifests.yaml
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	eirinix "code.cloudfoundry.org/eirinix"
+	"code.cloudfoundry.org/eirinix/cmd/render"
+)
+
+// LabelExtension labels the Eirini pods, in place of the extensions to render the manifests of
+type LabelExtension struct{}
+
+// Name returns the name of the webhook of the extension
+func (e *LabelExtension) Name() string {
+	return "label"
+}
+
+// Handle labels the pod
+func (e *LabelExtension) Handle(ctx context.Context, m eirinix.Manager, pod *corev1.Pod, req admission.Request) admission.Response {
+	podCopy := pod.DeepCopy()
+	if podCopy.Labels == nil {
+		podCopy.Labels = map[string]string{}
+	}
+	podCopy.Labels["example.eirinix.io/labelled"] = "true"
+	return m.PatchFromPod(req, podCopy)
+}
+
+func main() {
+	x := eirinix.NewManager(eirinix.ManagerOptions{
+		Namespace:           "eirini",
+		ServiceName:         "eirinix-example",
+		WebhookNamespace:    "cf",
+		OperatorFingerprint: "eirinix-example",
+	})
+	if err := x.AddExtension(&LabelExtension{}); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := render.Run(x, os.Args[1:], os.Stdout); err != nil {
+		log.Fatal(err)
+	}
+}
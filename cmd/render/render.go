@@ -0,0 +1,65 @@
+// Package render is a command rendering the manifests of the EiriniX extensions, see Manager.RenderManifests.
+//
+// It is meant to be embedded in the binary of the extensions, so that the manifests are rendered from the
+// same Extensions and ManagerOptions as the ones used at runtime:
+//
+//	x := eirinix.NewManager(eirinix.ManagerOptions{...})
+//	x.AddExtension(&MyExtension{})
+//	if len(os.Args) > 1 && os.Args[1] == "render" {
+//		if err := render.Run(x, os.Args[2:], os.Stdout); err != nil {
+//			log.Fatal(err)
+//		}
+//		return
+//	}
+//	log.Fatal(x.Start())
+//
+// The example command is a starting point for a binary rendering the manifests of its own extensions.
+package render
+
+import (
+	"flag"
+	"io"
+	"os"
+
+	"github.com/pkg/errors"
+
+	eirinix "code.cloudfoundry.org/eirinix"
+)
+
+// Run parses the command arguments, which override the ManagerOptions of the Manager, and writes
+// the manifests to out, or to the file given with -o.
+func Run(m eirinix.Manager, args []string, out io.Writer) error {
+	opts := m.GetManagerOptions()
+
+	flags := flag.NewFlagSet("render", flag.ContinueOnError)
+	output := flags.String("o", "", "file to write the manifests to, instead of the standard output")
+	flags.StringVar(&opts.Namespace, "namespace", opts.Namespace, "namespace where pods trigger the extensions, empty for all namespaces")
+	flags.StringVar(&opts.ServiceName, "service-name", opts.ServiceName, "service the webhooks are reachable by")
+	flags.StringVar(&opts.WebhookNamespace, "webhook-namespace", opts.WebhookNamespace, "namespace of the webhook service")
+	flags.StringVar(&opts.ServiceAccountName, "service-account", opts.ServiceAccountName, "service account the extensions run as, in the webhook namespace")
+	flags.StringVar(&opts.Host, "host", opts.Host, "listening host address of the webhook server")
+	port := flags.Int("port", int(opts.Port), "listening port of the webhook server")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	opts.Port = int32(*port)
+	// The webhooks are rendered even if the extensions don't register them at runtime, which is how they
+	// are deployed with the rendered manifests
+	registerWebHook := true
+	opts.RegisterWebHook = &registerWebHook
+	m.SetManagerOptions(opts)
+
+	if *output == "" {
+		return m.RenderManifests(out)
+	}
+
+	f, err := os.Create(*output)
+	if err != nil {
+		return errors.Wrapf(err, "creating %s", *output)
+	}
+	if err := m.RenderManifests(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
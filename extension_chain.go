@@ -0,0 +1,251 @@
+package extension
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+
+	jsonpatchapply "github.com/evanphx/json-patch"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"gomodules.xyz/jsonpatch/v2"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// ExtensionChain serves several Extensions from a single webhook.
+//
+// The Extensions run in the order they are given, each one receiving the pod as mutated by the previous ones.
+// Their patches are merged into a single patch response. The chain stops at the first Extension which
+// doesn't allow the pod, and its response is returned.
+//
+// Each Extension is given its own ExtensionTimeout, and its panics and timeouts are handled according to
+// its own failure policy: with Ignore, the chain goes on without its patches. Those settings are read from
+// the AdmissionOptions of the Extension, then from the ones of the chain and from the ManagerOptions.
+//
+// Extensions patching the same paths are handled according to the ConflictPolicy.
+type ExtensionChain struct {
+	name       string
+	extensions []Extension
+
+	// Options are the webhook settings of the chain, see WebhookOptionsProvider
+	Options AdmissionOptions
+
+	// ConflictPolicy overrides the PatchConflictPolicy of the ManagerOptions
+	ConflictPolicy PatchConflictPolicy
+}
+
+// NewExtensionChain returns an ExtensionChain running the extensions in order.
+// The name is the stable name of the webhook serving the chain, see Named.
+func NewExtensionChain(name string, extensions ...Extension) *ExtensionChain {
+	return &ExtensionChain{name: name, extensions: extensions}
+}
+
+// Name returns the name of the chain
+func (c *ExtensionChain) Name() string {
+	return c.name
+}
+
+// AdmissionOptions returns the webhook settings of the chain
+func (c *ExtensionChain) AdmissionOptions() AdmissionOptions {
+	return c.Options
+}
+
+// Extensions returns the extensions of the chain, in order
+func (c *ExtensionChain) Extensions() []Extension {
+	return c.extensions
+}
+
+// Handle runs the extensions of the chain and returns the patch between the pod of the request
+// and the pod mutated by all of them.
+func (c *ExtensionChain) Handle(ctx context.Context, m Manager, pod *corev1.Pod, req admission.Request) admission.Response {
+	original, err := json.Marshal(pod)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+
+	current := original
+	var warnings []string
+	patches := make([][]jsonpatch.JsonPatchOperation, 0, len(c.extensions))
+	annotations := map[string]string{}
+	for i, e := range c.extensions {
+		step := &corev1.Pod{}
+		if err := json.Unmarshal(current, step); err != nil {
+			return admission.Errored(http.StatusInternalServerError, err)
+		}
+
+		// Extensions compute their patches against the object of the request,
+		// which is the pod as mutated by the previous extensions.
+		stepReq := req
+		stepReq.Object.Raw = current
+		stepReq.Object.Object = nil
+
+		start := time.Now()
+		res, ok := c.runExtension(ctx, m, i, e, step, stepReq)
+		observeChainExtension(c.name, c.extensionName(i, e), stepReq, res, start)
+		if !ok {
+			patches = append(patches, nil)
+			continue
+		}
+		if !res.Allowed {
+			return res
+		}
+		warnings = append(warnings, res.Warnings...)
+		for k, v := range res.AuditAnnotations {
+			annotations[k] = v
+		}
+
+		p, err := ResponsePatches(res)
+		if err != nil {
+			return admission.Errored(http.StatusInternalServerError, errors.Wrapf(err, "reading the patches of extension %d of chain %s", i, c.name))
+		}
+		patches = append(patches, p)
+
+		current, err = applyPatches(current, p)
+		if err != nil {
+			return admission.Errored(http.StatusInternalServerError, errors.Wrapf(err, "applying the patches of extension %d of chain %s", i, c.name))
+		}
+	}
+
+	if err := c.checkConflicts(m, patches); err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+
+	res := admission.PatchResponseFromRaw(original, current)
+	res.Warnings = warnings
+	if len(annotations) > 0 {
+		res.AuditAnnotations = annotations
+	}
+	return res
+}
+
+// runExtension runs the i-th extension of the chain within its ExtensionTimeout, recovering its panics.
+// It returns false if the extension failed and its failure policy ignores the failure.
+func (c *ExtensionChain) runExtension(ctx context.Context, m Manager, i int, e Extension, pod *corev1.Pod, req admission.Request) (admission.Response, bool) {
+	timeout, failurePolicy := c.extensionPolicy(m, e)
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	// Buffered, so that an extension which answers after the deadline doesn't leak the goroutine forever
+	responses := make(chan admission.Response, 1)
+	panics := make(chan interface{}, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				chainLogger(m).Errorf("Extension %d of chain %s panicked handling the admission request %s: %v\n%s", i, c.name, req.UID, r, debug.Stack())
+				panics <- r
+			}
+		}()
+		responses <- e.Handle(ctx, m, pod, req)
+	}()
+
+	var res admission.Response
+	select {
+	case res = <-responses:
+		return res, true
+	case r := <-panics:
+		res = admission.Errored(http.StatusInternalServerError, fmt.Errorf("Extension %d of chain %s panicked: %v", i, c.name, r))
+	case <-ctx.Done():
+		chainLogger(m).Errorf("Extension %d of chain %s didn't answer the admission request %s: %v", i, c.name, req.UID, ctx.Err())
+		res = admission.Errored(http.StatusGatewayTimeout, fmt.Errorf("Extension %d of chain %s timed out after %s", i, c.name, timeout))
+	}
+	if failurePolicy == admissionregistrationv1.Ignore {
+		return res, false
+	}
+	return res, true
+}
+
+// extensionName returns the name of the i-th extension of the chain, or its index if it isn't Named
+func (c *ExtensionChain) extensionName(i int, e Extension) string {
+	if named, ok := unwrapExtension(e).(Named); ok {
+		return named.Name()
+	}
+	return strconv.Itoa(i)
+}
+
+// extensionPolicy returns the ExtensionTimeout and the failure policy of an extension of the chain
+func (c *ExtensionChain) extensionPolicy(m Manager, e Extension) (time.Duration, admissionregistrationv1.FailurePolicyType) {
+	var timeout time.Duration
+	failurePolicy := admissionregistrationv1.Fail
+	if m != nil {
+		opts := m.GetManagerOptions()
+		timeout = opts.ExtensionTimeout
+		if opts.FailurePolicy != nil {
+			failurePolicy = *opts.FailurePolicy
+		}
+	}
+
+	options := []AdmissionOptions{c.Options}
+	if p, ok := unwrapExtension(e).(WebhookOptionsProvider); ok {
+		options = append(options, p.AdmissionOptions())
+	}
+	for _, o := range options {
+		if o.ExtensionTimeout != nil {
+			timeout = *o.ExtensionTimeout
+		}
+		if o.FailurePolicy != nil {
+			failurePolicy = *o.FailurePolicy
+		}
+	}
+	return timeout, failurePolicy
+}
+
+// chainLogger returns the logger of the Manager, or a no-op logger
+func chainLogger(m Manager) *zap.SugaredLogger {
+	if m == nil || m.GetLogger() == nil {
+		return zap.NewNop().Sugar()
+	}
+	return m.GetLogger()
+}
+
+// checkConflicts applies the conflict policy to the patches of the extensions
+func (c *ExtensionChain) checkConflicts(m Manager, patches [][]jsonpatch.JsonPatchOperation) error {
+	policy := c.ConflictPolicy
+	if policy == "" && m != nil {
+		policy = m.GetManagerOptions().PatchConflictPolicy
+	}
+	if policy == PatchConflictPolicyIgnore {
+		return nil
+	}
+
+	conflicts := FindPatchConflicts(patches)
+	if len(conflicts) == 0 {
+		return nil
+	}
+
+	descriptions := make([]string, len(conflicts))
+	for i, conflict := range conflicts {
+		descriptions[i] = conflict.String()
+	}
+	if policy == PatchConflictPolicyFail {
+		return fmt.Errorf("Conflicting patches in chain %s: %s", c.name, strings.Join(descriptions, "; "))
+	}
+	chainLogger(m).Warnf("Conflicting patches in chain %s: %s", c.name, strings.Join(descriptions, "; "))
+	return nil
+}
+
+// applyPatches applies the JSON patch operations to the document
+func applyPatches(doc []byte, patches []jsonpatch.JsonPatchOperation) ([]byte, error) {
+	if len(patches) == 0 {
+		return doc, nil
+	}
+
+	raw, err := json.Marshal(patches)
+	if err != nil {
+		return nil, err
+	}
+	patch, err := jsonpatchapply.DecodePatch(raw)
+	if err != nil {
+		return nil, err
+	}
+	return patch.Apply(doc)
+}
@@ -0,0 +1,217 @@
+package extension_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	. "code.cloudfoundry.org/eirinix"
+	catalog "code.cloudfoundry.org/eirinix/testing"
+	jsonpatch "github.com/evanphx/json-patch"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+var _ = Describe("Extension chains", func() {
+	var (
+		eirinixcatalog catalog.Catalog
+		eiriniManager  *DefaultExtensionManager
+		pod            *corev1.Pod
+		raw            []byte
+	)
+
+	BeforeEach(func() {
+		var err error
+		eirinixcatalog = catalog.NewCatalog()
+		eiriniManager, _ = eirinixcatalog.SimpleManager().(*DefaultExtensionManager)
+		pod = &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "app"},
+			Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "opi", Image: "busybox"}}},
+		}
+		raw, err = json.Marshal(pod)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	handle := func(chain Extension) (admission.Response, *corev1.Pod) {
+		req := admission.Request{AdmissionRequest: admissionv1beta1.AdmissionRequest{
+			Operation: admissionv1beta1.Create,
+			Object:    runtime.RawExtension{Raw: raw},
+		}}
+		res := chain.Handle(context.Background(), eiriniManager, pod.DeepCopy(), req)
+
+		patches, err := json.Marshal(res.Patches)
+		Expect(err).ToNot(HaveOccurred())
+		patch, err := jsonpatch.DecodePatch(patches)
+		Expect(err).ToNot(HaveOccurred())
+		patched, err := patch.Apply(raw)
+		Expect(err).ToNot(HaveOccurred())
+		result := &corev1.Pod{}
+		Expect(json.Unmarshal(patched, result)).To(Succeed())
+		return res, result
+	}
+
+	It("merges the patches of the extensions", func() {
+		res, result := handle(NewExtensionChain("chain",
+			&catalog.EditEnvExtension{},
+			&catalog.AnnotatePodExtension{Key: "touched", Value: "yes"},
+		))
+		Expect(res.Allowed).To(BeTrue())
+		Expect(result.Annotations).To(HaveKeyWithValue("touched", "yes"))
+		Expect(result.Spec.Containers[0].Env).To(ContainElement(corev1.EnvVar{Name: "STICKY_MESSAGE", Value: "Eirinix is awesome!"}))
+	})
+
+	It("runs the extensions in order", func() {
+		_, result := handle(NewExtensionChain("chain",
+			&catalog.AnnotatePodExtension{Key: "order", Value: "first"},
+			&catalog.AnnotatePodExtension{Key: "order", Value: "second"},
+		))
+		Expect(result.Annotations).To(HaveKeyWithValue("order", "second"))
+	})
+
+	It("passes the mutated pod to the next extension", func() {
+		var seen map[string]string
+		_, result := handle(NewExtensionChain("chain",
+			&catalog.AnnotatePodExtension{Key: "touched", Value: "yes"},
+			extensionFunc(func(ctx context.Context, pod *corev1.Pod) {
+				seen = pod.Annotations
+			}),
+			&catalog.EditEnvExtension{},
+		))
+		Expect(seen).To(HaveKeyWithValue("touched", "yes"))
+		Expect(result.Annotations).To(HaveKeyWithValue("touched", "yes"))
+		Expect(result.Spec.Containers[0].Env).To(HaveLen(1))
+	})
+
+	It("stops at the first extension which denies the pod", func() {
+		called := false
+		chain := NewExtensionChain("chain",
+			&catalog.AnnotatePodExtension{Key: "touched", Value: "yes"},
+			denyExtension{},
+			extensionFunc(func(context.Context, *corev1.Pod) { called = true }),
+		)
+		res := chain.Handle(context.Background(), eiriniManager, pod, admission.Request{AdmissionRequest: admissionv1beta1.AdmissionRequest{
+			Object: runtime.RawExtension{Raw: raw},
+		}})
+		Expect(res.Allowed).To(BeFalse())
+		Expect(string(res.Result.Reason)).To(Equal("denied"))
+		Expect(called).To(BeFalse())
+	})
+
+	Context("with timeouts", func() {
+		BeforeEach(func() {
+			failurePolicy := admissionregistrationv1.Fail
+			eiriniManager.Options.FailurePolicy = &failurePolicy
+		})
+
+		It("gives each extension its own timeout", func() {
+			eiriniManager.Options.ExtensionTimeout = 150 * time.Millisecond
+			chain := NewExtensionChain("pod-mutations",
+				&slowExtension{delay: 100 * time.Millisecond, extension: &catalog.AnnotatePodExtension{Key: "first", Value: "yes"}},
+				&slowExtension{delay: 100 * time.Millisecond, extension: &catalog.AnnotatePodExtension{Key: "second", Value: "yes"}},
+			)
+
+			w := NewWebhook(chain, eiriniManager)
+			Expect(w.RegisterAdmissionWebHook(&webhook.Server{}, WebhookOptions{ID: chain.Name(), ManagerOptions: eiriniManager.Options})).To(Succeed())
+			decoder, err := admission.NewDecoder(scheme.Scheme)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(w.InjectDecoder(decoder)).To(Succeed())
+			res := w.Handle(context.Background(), admission.Request{AdmissionRequest: admissionv1beta1.AdmissionRequest{
+				Operation: admissionv1beta1.Create,
+				Object:    runtime.RawExtension{Raw: raw},
+			}})
+			Expect(res.Allowed).To(BeTrue())
+			Expect(res.Patches).To(HaveLen(1))
+			Expect(res.Patches[0].Value).To(Equal(map[string]interface{}{"first": "yes", "second": "yes"}))
+		})
+
+		It("goes on without the extensions failing with the Ignore policy", func() {
+			ignore := admissionregistrationv1.Ignore
+			timeout := 10 * time.Millisecond
+			_, mutated := handle(NewExtensionChain("pod-mutations",
+				&slowExtension{
+					delay:     time.Second,
+					extension: &catalog.AnnotatePodExtension{Key: "slow", Value: "yes"},
+					options:   AdmissionOptions{ExtensionTimeout: &timeout, FailurePolicy: &ignore},
+				},
+				&slowExtension{
+					extension: &panicExtension{},
+					options:   AdmissionOptions{FailurePolicy: &ignore},
+				},
+				&catalog.AnnotatePodExtension{Key: "fast", Value: "yes"},
+			))
+			Expect(mutated.Annotations).To(Equal(map[string]string{"fast": "yes"}))
+		})
+
+		It("rejects the pod when an extension with the Fail policy times out", func() {
+			timeout := 10 * time.Millisecond
+			chain := NewExtensionChain("pod-mutations",
+				&catalog.AnnotatePodExtension{Key: "fast", Value: "yes"},
+				&slowExtension{delay: time.Second, extension: &catalog.AnnotatePodExtension{Key: "slow", Value: "yes"}, options: AdmissionOptions{ExtensionTimeout: &timeout}},
+			)
+			res := chain.Handle(context.Background(), eiriniManager, pod.DeepCopy(), admission.Request{AdmissionRequest: admissionv1beta1.AdmissionRequest{
+				Object: runtime.RawExtension{Raw: raw},
+			}})
+			Expect(res.Allowed).To(BeFalse())
+			Expect(res.Result.Code).To(Equal(int32(http.StatusGatewayTimeout)))
+			Expect(res.Result.Message).To(Equal("Extension 1 of chain pod-mutations timed out after 10ms"))
+		})
+	})
+
+	It("is served by a single webhook named after the chain", func() {
+		failurePolicy := admissionregistrationv1.Fail
+		eiriniManager.Options.FailurePolicy = &failurePolicy
+		eiriniManager.Options.OperatorFingerprint = "eirini-x"
+		chain := NewExtensionChain("pod-mutations", &catalog.EditEnvExtension{}, &catalog.AnnotatePodExtension{Key: "touched", Value: "yes"})
+
+		w := NewWebhook(chain, eiriniManager)
+		Expect(w.RegisterAdmissionWebHook(&webhook.Server{}, WebhookOptions{ID: chain.Name(), ManagerOptions: eiriniManager.Options})).To(Succeed())
+		Expect(w.GetPath()).To(Equal("/pod-mutations"))
+
+		decoder, err := admission.NewDecoder(scheme.Scheme)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(w.InjectDecoder(decoder)).To(Succeed())
+		res := w.Handle(context.Background(), admission.Request{AdmissionRequest: admissionv1beta1.AdmissionRequest{
+			Operation: admissionv1beta1.Create,
+			Object:    runtime.RawExtension{Raw: raw},
+		}})
+		Expect(res.Allowed).To(BeTrue())
+		Expect(res.Patches).ToNot(BeEmpty())
+	})
+})
+
+// slowExtension delays the Extension, and declares the admission options
+type slowExtension struct {
+	delay     time.Duration
+	extension Extension
+	options   AdmissionOptions
+}
+
+func (e *slowExtension) AdmissionOptions() AdmissionOptions {
+	return e.options
+}
+
+func (e *slowExtension) Handle(ctx context.Context, m Manager, pod *corev1.Pod, req admission.Request) admission.Response {
+	time.Sleep(e.delay)
+	return e.extension.Handle(ctx, m, pod, req)
+}
+
+type panicExtension struct{}
+
+func (panicExtension) Handle(context.Context, Manager, *corev1.Pod, admission.Request) admission.Response {
+	panic("extension bug")
+}
+
+type denyExtension struct{}
+
+func (denyExtension) Handle(context.Context, Manager, *corev1.Pod, admission.Request) admission.Response {
+	return admission.Denied("denied")
+}
@@ -0,0 +1,153 @@
+package extension
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"path"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/afero"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	machinerytypes "k8s.io/apimachinery/pkg/types"
+)
+
+// DefaultExternalCertificateCheckInterval is the interval between two reads of the external certificates
+const DefaultExternalCertificateCheckInterval = time.Minute
+
+// ExternalCertificate configures the webhook server to use certificates issued by a third party,
+// e.g. cert-manager, instead of generating them.
+//
+// The certificates are read either from a directory, typically a mounted Secret, or from a Secret.
+// Both hold the tls.crt, tls.key and ca.crt files, following the kubernetes.io/tls Secrets and cert-manager conventions.
+type ExternalCertificate struct {
+	// Dir is the directory containing the certificates. The webhook server serves them from there.
+	Dir string
+
+	// SecretName is the name of the Secret containing the certificates, if Dir is empty
+	SecretName string
+
+	// SecretNamespace is the namespace of the Secret. Optional, defaults to the WebhookNamespace
+	SecretNamespace string
+
+	// CAFile is the path of the CA bundle. Optional, defaults to the ca.crt file of Dir
+	CAFile string
+
+	// CAKey is the key of the CA bundle in the Secret. Optional, defaults to ca.crt
+	CAKey string
+
+	// CheckInterval is the interval between two reads of the certificates.
+	// Optional, defaults to DefaultExternalCertificateCheckInterval
+	CheckInterval time.Duration
+}
+
+func (e *ExternalCertificate) validate() error {
+	if e.Dir == "" && e.SecretName == "" {
+		return errors.New("The external certificate needs a directory or a secret name")
+	}
+	if e.Dir != "" && e.SecretName != "" {
+		return errors.New("The external certificate can't be read from both a directory and a secret")
+	}
+	return nil
+}
+
+// loadExternalCertificate reads the certificates from the external source.
+// It returns true if the certificates changed since the previous read.
+func (f *WebhookConfig) loadExternalCertificate(ctx context.Context, e *ExternalCertificate) (bool, error) {
+	if err := e.validate(); err != nil {
+		return false, err
+	}
+
+	var cert, key, caCert []byte
+	var err error
+	if e.Dir != "" {
+		cert, key, caCert, err = f.readExternalCertificateDir(e)
+	} else {
+		cert, key, caCert, err = f.readExternalCertificateSecret(ctx, e)
+	}
+	if err != nil {
+		return false, err
+	}
+	if len(caCert) == 0 {
+		return false, errors.New("The external CA bundle is empty")
+	}
+
+	changed := !bytes.Equal(cert, f.Certificate) || !bytes.Equal(key, f.Key) || !bytes.Equal(caCert, f.CaCertificate)
+	if len(f.CaCertificate) > 0 && !bytes.Equal(caCert, f.CaCertificate) {
+		f.previousCaCertificate = f.CaCertificate
+	}
+	f.Certificate = cert
+	f.Key = key
+	f.CaCertificate = caCert
+	f.CaKey = nil
+	f.observeCertificateExpiry()
+
+	// The webhook server reads the certificates from CertDir, which is the external directory itself
+	if e.Dir == "" && changed {
+		if err := f.writeTLSFiles(); err != nil {
+			return false, errors.Wrap(err, "writing webhook certificate files to disk")
+		}
+	}
+	return changed, nil
+}
+
+func (f *WebhookConfig) readExternalCertificateDir(e *ExternalCertificate) ([]byte, []byte, []byte, error) {
+	caFile := e.CAFile
+	if caFile == "" {
+		caFile = path.Join(e.Dir, "ca.crt")
+	}
+
+	cert, err := afero.ReadFile(f.config.Fs, path.Join(e.Dir, "tls.crt"))
+	if err != nil {
+		return nil, nil, nil, errors.Wrap(err, "reading the external certificate")
+	}
+	key, err := afero.ReadFile(f.config.Fs, path.Join(e.Dir, "tls.key"))
+	if err != nil {
+		return nil, nil, nil, errors.Wrap(err, "reading the external certificate key")
+	}
+	caCert, err := afero.ReadFile(f.config.Fs, caFile)
+	if err != nil {
+		return nil, nil, nil, errors.Wrap(err, "reading the external CA bundle")
+	}
+	return cert, key, caCert, nil
+}
+
+func (f *WebhookConfig) readExternalCertificateSecret(ctx context.Context, e *ExternalCertificate) ([]byte, []byte, []byte, error) {
+	namespace := e.SecretNamespace
+	if namespace == "" {
+		namespace = f.webhookNamespace
+	}
+	caKey := e.CAKey
+	if caKey == "" {
+		caKey = "ca.crt"
+	}
+
+	// Unstructured, as the cache of the structured client isn't started yet, see setupCertificate
+	secret := &unstructured.Unstructured{}
+	secret.SetGroupVersionKind(schema.GroupVersionKind{
+		Group:   "",
+		Kind:    "Secret",
+		Version: "v1",
+	})
+	err := f.client.Get(ctx, machinerytypes.NamespacedName{Name: e.SecretName, Namespace: namespace}, secret)
+	if err != nil {
+		return nil, nil, nil, errors.Wrapf(err, "getting the external certificate secret %s/%s", namespace, e.SecretName)
+	}
+
+	data, _ := secret.Object["data"].(map[string]interface{})
+	var values [3][]byte
+	for i, field := range []string{"tls.crt", "tls.key", caKey} {
+		value, ok := data[field].(string)
+		if !ok {
+			return nil, nil, nil, fmt.Errorf("The external certificate secret %s/%s has no %s", namespace, e.SecretName, field)
+		}
+		values[i], err = base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return nil, nil, nil, errors.Wrapf(err, "decoding %s", field)
+		}
+	}
+	return values[0], values[1], values[2], nil
+}
@@ -0,0 +1,120 @@
+package extension
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"path"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/afero"
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+// healthCheckTimeout is the time a built-in health check waits for its result
+const healthCheckTimeout = time.Second
+
+// healthCheck is a named check of the health probes
+type healthCheck struct {
+	name  string
+	check healthz.Checker
+}
+
+// AddReadinessCheck adds a check to the readiness probe, see HealthProbeBindAddress.
+// The manager is ready once all the checks succeed.
+func (m *DefaultExtensionManager) AddReadinessCheck(name string, check healthz.Checker) {
+	m.readinessChecks = append(m.readinessChecks, healthCheck{name: name, check: check})
+}
+
+// AddLivenessCheck adds a check to the liveness probe, see HealthProbeBindAddress.
+// The manager is alive as long as all the checks succeed.
+func (m *DefaultExtensionManager) AddLivenessCheck(name string, check healthz.Checker) {
+	m.livenessChecks = append(m.livenessChecks, healthCheck{name: name, check: check})
+}
+
+// setupHealthChecks adds the built-in checks and the checks of the extensions to the probes of the kube manager
+func (m *DefaultExtensionManager) setupHealthChecks() error {
+	readiness := append([]healthCheck{
+		{name: "certificates", check: m.certificatesWritten},
+		{name: "webhooks", check: m.webhooksRegistered},
+		{name: "cache", check: m.cacheSynced},
+	}, m.readinessChecks...)
+	for _, c := range readiness {
+		if err := m.KubeManager.AddReadyzCheck(c.name, c.check); err != nil {
+			return errors.Wrapf(err, "adding the %s readiness check", c.name)
+		}
+	}
+
+	liveness := append([]healthCheck{
+		{name: "webhook-server", check: m.webhookServerListening},
+		{name: "watcher", check: m.watcherRunning},
+	}, m.livenessChecks...)
+	for _, c := range liveness {
+		if err := m.KubeManager.AddHealthzCheck(c.name, c.check); err != nil {
+			return errors.Wrapf(err, "adding the %s liveness check", c.name)
+		}
+	}
+	return nil
+}
+
+// certificatesWritten checks that the webhook server certificates are in the certificates directory
+func (m *DefaultExtensionManager) certificatesWritten(_ *http.Request) error {
+	if m.WebhookConfig == nil {
+		return errors.New("The webhook server isn't set up yet")
+	}
+	for _, file := range []string{"tls.crt", "tls.key"} {
+		if exists, _ := afero.Exists(m.WebhookConfig.config.Fs, path.Join(m.WebhookConfig.CertDir, file)); !exists {
+			return fmt.Errorf("The webhook server certificate %s isn't written yet", file)
+		}
+	}
+	return nil
+}
+
+// webhooksRegistered checks that the Extensions are loaded, see LoadExtensions
+func (m *DefaultExtensionManager) webhooksRegistered(_ *http.Request) error {
+	if atomic.LoadInt32(&m.registered) == 0 {
+		return errors.New("The extensions aren't registered yet")
+	}
+	return nil
+}
+
+// cacheSynced checks that the cache of the kube manager is started and synced
+func (m *DefaultExtensionManager) cacheSynced(req *http.Request) error {
+	ctx, cancel := context.WithTimeout(req.Context(), healthCheckTimeout)
+	defer cancel()
+	if !m.KubeManager.GetCache().WaitForCacheSync(ctx.Done()) {
+		return errors.New("The kube cache isn't synced yet")
+	}
+	return nil
+}
+
+// webhookServerListening checks that the webhook server accepts connections on the port it serves on,
+// which controller-runtime defaults to webhook.DefaultPort when Port isn't set
+func (m *DefaultExtensionManager) webhookServerListening(_ *http.Request) error {
+	host, port := m.Options.Host, int(m.Options.Port)
+	if m.WebhookServer != nil {
+		host, port = m.WebhookServer.Host, m.WebhookServer.Port
+	}
+	if port <= 0 {
+		port = webhook.DefaultPort
+	}
+	address := net.JoinHostPort(host, strconv.Itoa(port))
+	conn, err := net.DialTimeout("tcp", address, healthCheckTimeout)
+	if err != nil {
+		return errors.Wrap(err, "connecting to the webhook server")
+	}
+	return conn.Close()
+}
+
+// watcherRunning checks that the watch loop didn't give up, see RunWatchers
+func (m *DefaultExtensionManager) watcherRunning(_ *http.Request) error {
+	if atomic.LoadInt32(&m.watchFailed) != 0 {
+		return errors.New("A watch failed")
+	}
+	return nil
+}
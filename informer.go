@@ -0,0 +1,186 @@
+package extension
+
+import (
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// WatcherMode defines how the pods are watched
+type WatcherMode string
+
+const (
+	// WatcherModeWatch passes the events of a watch of the pods to the Watchers. It is the default
+	WatcherModeWatch WatcherMode = "Watch"
+	// WatcherModeInformer passes the events of a shared informer of the pods to the Watchers, which can read
+	// the pods of its cache with GetPodLister
+	WatcherModeInformer WatcherMode = "Informer"
+)
+
+// PodEventHandler is an optional interface a Watcher can implement to receive typed callbacks with
+// WatcherModeInformer, instead of the events passed to its Handle method.
+//
+// OnUpdate receives the pod before and after the change. It is also called on each resync, with the same
+// pod twice. OnDelete receives the last known state of the pod, which can be stale if the deletion was missed.
+type PodEventHandler interface {
+	OnAdd(m Manager, pod *corev1.Pod)
+	OnUpdate(m Manager, oldPod, newPod *corev1.Pod)
+	OnDelete(m Manager, pod *corev1.Pod)
+}
+
+// ErrPodInformerNotRunning is returned by GetPodLister when the pods aren't watched with WatcherModeInformer
+var ErrPodInformerNotRunning = errors.New("the pod informer isn't running")
+
+// GetPodLister returns the lister of the pods cached by the informer of the Watchers, which run with
+// WatcherModeInformer. The lister is available once the cache is synced and until the Watchers stop,
+// it is updated before the Watchers receive the events.
+func (m *DefaultExtensionManager) GetPodLister() (corelisters.PodLister, error) {
+	m.watcherMutex.Lock()
+	defer m.watcherMutex.Unlock()
+	if m.podLister == nil {
+		return nil, ErrPodInformerNotRunning
+	}
+	return m.podLister, nil
+}
+
+// genPodInformer generates a shared informer of the pods selected by the Watchers
+func (m *DefaultExtensionManager) genPodInformer(client corev1client.CoreV1Interface) (cache.SharedIndexInformer, error) {
+	podInterface := client.Pods(m.Options.Namespace)
+	labelSelector, fieldSelector, err := m.podSelectors()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := m.Context
+	return cache.NewSharedIndexInformer(&cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			options.LabelSelector = labelSelector.String()
+			options.FieldSelector = fieldSelector.String()
+			return podInterface.List(ctx, options)
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			options.LabelSelector = labelSelector.String()
+			options.FieldSelector = fieldSelector.String()
+			return podInterface.Watch(ctx, options)
+		},
+	}, &corev1.Pod{}, m.Options.InformerResyncPeriod, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc}), nil
+}
+
+// runPodInformer runs an informer of the pods passing their events to the Watchers until stopPodInformer
+func (m *DefaultExtensionManager) runPodInformer() error {
+	client, err := m.GetKubeClient()
+	if err != nil {
+		return err
+	}
+	informer, err := m.genPodInformer(client)
+	if err != nil {
+		return err
+	}
+	for i, w := range m.Watchers {
+		if _, ok := w.(ResourceWatcher); ok {
+			continue
+		}
+		informer.AddEventHandler(m.podEventHandler(watcherName(i, w), w))
+	}
+
+	m.watcherMutex.Lock()
+	if m.watcherStopped {
+		m.watcherMutex.Unlock()
+		return nil
+	}
+	stop := make(chan struct{})
+	m.informerStop = stop
+	m.watcherMutex.Unlock()
+
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		informer.Run(stop)
+	}()
+
+	// The lister is published once the cache holds the pods listed at start, it's empty until then
+	if cache.WaitForCacheSync(stop, informer.HasSynced) {
+		m.watcherMutex.Lock()
+		if m.informerStop == stop {
+			m.podLister = corelisters.NewPodLister(informer.GetIndexer())
+		}
+		m.watcherMutex.Unlock()
+	}
+
+	<-finished
+	return nil
+}
+
+// stopPodInformer stops the informer of the pods, which makes runPodInformer return, and the informers started afterwards
+func (m *DefaultExtensionManager) stopPodInformer() {
+	m.watcherMutex.Lock()
+	defer m.watcherMutex.Unlock()
+	m.watcherStopped = true
+	m.podLister = nil
+	if m.informerStop != nil {
+		close(m.informerStop)
+		m.informerStop = nil
+	}
+}
+
+// podEventHandler returns the handler of the informer events for the named Watcher, which receives them in its
+// own goroutine
+func (m *DefaultExtensionManager) podEventHandler(name string, w Watcher) cache.ResourceEventHandler {
+	selects := func(eventType watch.EventType, pod *corev1.Pod) bool {
+		e := watch.Event{Type: eventType, Object: pod}
+		if !watcherSelects(w, e) {
+			return false
+		}
+		observeWatcherEvent(name, e)
+		return true
+	}
+	handler, typed := w.(PodEventHandler)
+
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			pod, ok := obj.(*corev1.Pod)
+			if !ok || !selects(watch.Added, pod) {
+				return
+			}
+			if typed {
+				handler.OnAdd(m, pod)
+				return
+			}
+			w.Handle(m, watch.Event{Type: watch.Added, Object: pod})
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			oldPod, ok := oldObj.(*corev1.Pod)
+			if !ok {
+				return
+			}
+			pod, ok := newObj.(*corev1.Pod)
+			if !ok || !selects(watch.Modified, pod) {
+				return
+			}
+			if typed {
+				handler.OnUpdate(m, oldPod, pod)
+				return
+			}
+			w.Handle(m, watch.Event{Type: watch.Modified, Object: pod})
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			pod, ok := obj.(*corev1.Pod)
+			if !ok || !selects(watch.Deleted, pod) {
+				return
+			}
+			if typed {
+				handler.OnDelete(m, pod)
+				return
+			}
+			w.Handle(m, watch.Event{Type: watch.Deleted, Object: pod})
+		},
+	}
+}
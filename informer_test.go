@@ -0,0 +1,133 @@
+package extension_test
+
+import (
+	"context"
+	"time"
+
+	. "code.cloudfoundry.org/eirinix"
+	catalog "code.cloudfoundry.org/eirinix/testing"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes/fake"
+	corelisters "k8s.io/client-go/listers/core/v1"
+)
+
+var _ = Describe("Pod informer", func() {
+	var (
+		eirinixcatalog catalog.Catalog
+		eiriniManager  *DefaultExtensionManager
+		clientset      *fake.Clientset
+		podEvents      chan catalog.PodEvent
+		events         chan watch.Event
+		stop           chan struct{}
+		stopped        bool
+		done           chan error
+	)
+
+	pod := func(name, phase string) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "namespace", Labels: map[string]string{LabelSourceType: "APP"}},
+			Status:     corev1.PodStatus{Phase: corev1.PodPhase(phase)},
+		}
+	}
+
+	BeforeEach(func() {
+		eirinixcatalog = catalog.NewCatalog()
+		eiriniManager = eirinixcatalog.SimpleManager().(*DefaultExtensionManager)
+		eiriniManager.Options.WatcherMode = WatcherModeInformer
+
+		clientset = fake.NewSimpleClientset(pod("foo", "Pending"))
+		eiriniManager.SetKubeClient(clientset.CoreV1())
+
+		podEvents = make(chan catalog.PodEvent, 10)
+		events = make(chan watch.Event, 10)
+		eiriniManager.AddWatcher(eirinixcatalog.PodEventWatcher(podEvents))
+		eiriniManager.AddWatcher(eirinixcatalog.SimpleWatcherWithChannel(events))
+		stop = make(chan struct{})
+		stopped = false
+		done = make(chan error)
+	})
+
+	run := func() {
+		go func() {
+			done <- eiriniManager.RunWatchers(stop)
+		}()
+	}
+
+	AfterEach(func() {
+		if stopped {
+			return
+		}
+		close(stop)
+		Eventually(done, 5*time.Second).Should(Receive(BeNil()))
+	})
+
+	It("calls the typed callbacks with the old and new pods", func() {
+		run()
+
+		var e catalog.PodEvent
+		Eventually(podEvents, 5*time.Second).Should(Receive(&e))
+		Expect(e.Type).To(Equal(watch.Added))
+		Expect(e.Pod.Name).To(Equal("foo"))
+
+		_, err := clientset.CoreV1().Pods("namespace").Update(context.Background(), pod("foo", "Running"), metav1.UpdateOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		Eventually(podEvents, 5*time.Second).Should(Receive(&e))
+		Expect(e.Type).To(Equal(watch.Modified))
+		Expect(e.OldPod.Status.Phase).To(Equal(corev1.PodPending))
+		Expect(e.Pod.Status.Phase).To(Equal(corev1.PodRunning))
+
+		Expect(clientset.CoreV1().Pods("namespace").Delete(context.Background(), "foo", metav1.DeleteOptions{})).To(Succeed())
+		Eventually(podEvents, 5*time.Second).Should(Receive(&e))
+		Expect(e.Type).To(Equal(watch.Deleted))
+		Expect(e.Pod.Status.Phase).To(Equal(corev1.PodRunning))
+	})
+
+	It("passes the events to the other watchers", func() {
+		run()
+
+		var e watch.Event
+		Eventually(events, 5*time.Second).Should(Receive(&e))
+		Expect(e.Type).To(Equal(watch.Added))
+		Expect(e.Object.(*corev1.Pod).Name).To(Equal("foo"))
+
+		Expect(clientset.CoreV1().Pods("namespace").Delete(context.Background(), "foo", metav1.DeleteOptions{})).To(Succeed())
+		Eventually(events, 5*time.Second).Should(Receive(&e))
+		Expect(e.Type).To(Equal(watch.Deleted))
+	})
+
+	It("gives access to the cached pods", func() {
+		_, err := eiriniManager.GetPodLister()
+		Expect(err).To(Equal(ErrPodInformerNotRunning))
+		run()
+
+		var lister corelisters.PodLister
+		Eventually(func() error {
+			lister, err = eiriniManager.GetPodLister()
+			return err
+		}, 5*time.Second).Should(Succeed())
+		cached, err := lister.Pods("namespace").Get("foo")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(cached.Status.Phase).To(Equal(corev1.PodPending))
+
+		close(stop)
+		Eventually(done, 5*time.Second).Should(Receive(BeNil()))
+		stopped = true
+		_, err = eiriniManager.GetPodLister()
+		Expect(err).To(Equal(ErrPodInformerNotRunning))
+	})
+
+	It("resyncs the cached pods periodically", func() {
+		eiriniManager.Options.InformerResyncPeriod = time.Second
+		run()
+		Eventually(podEvents, 5*time.Second).Should(Receive())
+
+		var e catalog.PodEvent
+		Eventually(podEvents, 5*time.Second).Should(Receive(&e))
+		Expect(e.Type).To(Equal(watch.Modified))
+		Expect(e.OldPod).To(Equal(e.Pod))
+	})
+})
@@ -2,17 +2,25 @@ package extension
 
 import (
 	"context"
+	"io"
 
 	"go.uber.org/zap"
-	admissionregistrationv1beta1 "k8s.io/api/admissionregistration/v1beta1"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/watch"
 
+	"k8s.io/client-go/dynamic"
 	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
 	"k8s.io/client-go/rest"
 
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
@@ -32,9 +40,75 @@ type Extension interface {
 	// decoded payloads from the kubeapi server.
 	//
 	// The manager will attempt to decode a pod from the request if possible and passes it to the Manager.
+	// On UPDATE requests, the pod before the change is available with OldPodFromContext.
 	Handle(context.Context, Manager, *corev1.Pod, admission.Request) admission.Response
 }
 
+// ResourceExtension is the Eirini Extension interface for resources other than pods
+//
+// A ResourceExtension declares the kind of the objects it handles. The manager derives the webhook
+// rules from it and decodes the objects of the requests before passing them to the Handle method.
+type ResourceExtension interface {
+	// GroupVersionKind returns the kind of the objects handled by the Extension
+	GroupVersionKind() schema.GroupVersionKind
+
+	// Handle handles a kubernetes request.
+	//
+	// The object is decoded from the request: it is a typed object for the kinds known to the
+	// kubernetes scheme (e.g. *appsv1.StatefulSet), and an *unstructured.Unstructured otherwise.
+	// On UPDATE requests, the object before the change is available with OldObjectFromContext.
+	Handle(context.Context, Manager, runtime.Object, admission.Request) admission.Response
+}
+
+// StatefulSetExtension is the Eirini Extension interface for StatefulSets
+type StatefulSetExtension interface {
+	Handle(context.Context, Manager, *appsv1.StatefulSet, admission.Request) admission.Response
+}
+
+// JobExtension is the Eirini Extension interface for Jobs, e.g. the Eirini staging Jobs
+type JobExtension interface {
+	Handle(context.Context, Manager, *batchv1.Job, admission.Request) admission.Response
+}
+
+// Validator is the Eirini Validator Extension interface
+//
+// An Eirini Validator must implement a Validate method, which decides whether the pod received in
+// the request is admitted. Validators are registered in a ValidatingWebhookConfiguration, so they
+// see the pods after all the mutations are applied.
+type Validator interface {
+	// Validate validates a kubernetes request.
+	//
+	// The manager will attempt to decode a pod from the request if possible and passes it to the Validator.
+	// On UPDATE requests, the pod before the change is available with OldPodFromContext.
+	Validate(context.Context, Manager, *corev1.Pod, admission.Request) ValidationResult
+}
+
+// DecodeErrorHandler is an optional interface an Extension or a Validator can implement
+// to handle the requests whose object can't be decoded.
+//
+// Without it, those requests are handled according to the DecodeErrorPolicy of the ManagerOptions.
+type DecodeErrorHandler interface {
+	HandleDecodeError(context.Context, Manager, admission.Request, error) admission.Response
+}
+
+// WebhookOptionsProvider is an optional interface an Extension can implement
+// to customize the webhook generated for it.
+//
+// The returned AdmissionOptions take precedence over the ManagerOptions, so extensions with
+// different operations, resources or failure policies can share the same Manager.
+type WebhookOptionsProvider interface {
+	AdmissionOptions() AdmissionOptions
+}
+
+// Named is an optional interface an Extension can implement to get a stable name.
+//
+// The name is used to generate the webhook path and the webhook name, so they don't depend
+// on the order in which the Extensions are added to the Manager. It must be a valid DNS label
+// and unique in the Manager.
+type Named interface {
+	Name() string
+}
+
 // Watcher is the Eirini Watcher Extension interface.
 //
 // An Eirini Watcher must implement a Handle method, which is called with the event that occurred in the
@@ -43,6 +117,15 @@ type Watcher interface {
 	Handle(Manager, watch.Event)
 }
 
+// ResourceWatcher is an optional interface a Watcher can implement to watch other resources than the pods.
+//
+// The Watcher then receives the events of the resources declared by WatchOptions, instead of the pod events.
+// The ResourceWatchers asking for the same resource with the same selectors share the same watch.
+type ResourceWatcher interface {
+	Watcher
+	WatchOptions() WatchOptions
+}
+
 // Reconciler is the Eirini Reconciler Extension interface
 //
 // An Eirini Reconciler must implement a Reconcile method which is called when
@@ -52,12 +135,11 @@ type Reconciler interface {
 	Register(Manager) error
 }
 
-// MutatingWebhook is the interface of the generated webhook
-// from the Extension
+// AdmissionWebhook is the interface shared by the generated webhooks
 //
 // It represent the minimal set of methods that the libraries used behind the scenes expect from a structure
-// that implements a Mutating Webhook
-type MutatingWebhook interface {
+// that implements an Admission Webhook
+type AdmissionWebhook interface {
 	Handle(context.Context, admission.Request) admission.Response
 	InjectClient(c client.Client) error
 	InjectDecoder(d *admission.Decoder) error
@@ -65,14 +147,34 @@ type MutatingWebhook interface {
 
 	GetName() string
 	GetPath() string
-	GetRules() []admissionregistrationv1beta1.RuleWithOperations
-	GetFailurePolicy() admissionregistrationv1beta1.FailurePolicyType
+	GetRules() []admissionregistrationv1.RuleWithOperations
+	GetFailurePolicy() admissionregistrationv1.FailurePolicyType
+	GetSideEffects() admissionregistrationv1.SideEffectClass
+	GetTimeoutSeconds() int32
+	GetMatchPolicy() admissionregistrationv1.MatchPolicyType
 	GetNamespaceSelector() *metav1.LabelSelector
 	GetLabelSelector() *metav1.LabelSelector
 	GetHandler() admission.Handler
 	GetWebhook() *webhook.Admission
 }
 
+// MutatingWebhook is the interface of the generated webhook
+// from the Extension
+//
+// It represent the minimal set of methods that the libraries used behind the scenes expect from a structure
+// that implements a Mutating Webhook
+type MutatingWebhook interface {
+	AdmissionWebhook
+
+	GetReinvocationPolicy() admissionregistrationv1.ReinvocationPolicyType
+}
+
+// ValidatingWebhook is the interface of the generated webhook
+// from the Validator
+type ValidatingWebhook interface {
+	AdmissionWebhook
+}
+
 // Manager is the interface of the manager for registering Eirini extensions
 //
 // It will generate webhooks that will satisfy the MutatingWebhook interface from the defined Extensions.
@@ -102,6 +204,12 @@ type Manager interface {
 	// ListReconcilers returns a list of the current loaded Reconcilers
 	ListReconcilers() []Reconciler
 
+	// ListValidators returns a list of the current loaded Validators
+	ListValidators() []Validator
+
+	// ListResourceExtensions returns a list of the current loaded ResourceExtensions
+	ListResourceExtensions() []ResourceExtension
+
 	// GetContext returns the context of the manager, which can be used in internall cals by extension
 	GetContext() context.Context
 
@@ -119,6 +227,16 @@ type Manager interface {
 	// Returns the kubernetes interface.
 	GetKubeClient() (corev1client.CoreV1Interface, error)
 
+	// GetDynamicClient sets up a kube dynamic client if not already present
+	//
+	// Returns the dynamic interface, which the ResourceWatchers are watching with.
+	GetDynamicClient() (dynamic.Interface, error)
+
+	// GetPodLister returns the lister of the pods cached by the informer of the Watchers
+	//
+	// Returns ErrPodInformerNotRunning unless the Watchers run with WatcherModeInformer.
+	GetPodLister() (corelisters.PodLister, error)
+
 	// GetLogger returns the logger of the application. It can be passed an already existing one
 	// by using NewManager()
 	GetLogger() *zap.SugaredLogger
@@ -132,12 +250,29 @@ type Manager interface {
 	// Helper to compute the patch from a pod update
 	PatchFromPod(req admission.Request, pod *corev1.Pod) admission.Response
 
+	// Helper to compute the patch from an object update
+	PatchFromObject(req admission.Request, obj runtime.Object) admission.Response
+
 	// Register Extensions to the kubernetes cluster.
 	RegisterExtensions() error
 
+	// RenderManifests writes the objects that RegisterExtensions creates in the kubernetes cluster, and the
+	// roles the manager needs, as YAML. It doesn't connect to the cluster.
+	RenderManifests(w io.Writer) error
+
+	// UnregisterExtensions removes from the kubernetes cluster the webhooks, the certificates and the
+	// namespace label registered for the OperatorFingerprint.
+	UnregisterExtensions() error
+
 	// Stop stops the manager execution
 	Stop()
 
+	// AddReadinessCheck adds a check to the readiness probe served on the HealthProbeBindAddress
+	AddReadinessCheck(name string, check healthz.Checker)
+
+	// AddLivenessCheck adds a check to the liveness probe served on the HealthProbeBindAddress
+	AddLivenessCheck(name string, check healthz.Checker)
+
 	// SetManagerOptions it is a setter for the ManagerOptions
 	SetManagerOptions(ManagerOptions)
 
@@ -1,11 +1,16 @@
 package extension
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
+	"math"
 	"net/http"
 	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"code.cloudfoundry.org/eirinix/util/ctxlog"
@@ -15,21 +20,30 @@ import (
 	"github.com/pkg/errors"
 	"github.com/spf13/afero"
 	"go.uber.org/zap"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
 	admissionregistrationv1beta1 "k8s.io/api/admissionregistration/v1beta1"
 	corev1 "k8s.io/api/core/v1"
 	meta "k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	fields "k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/selection"
 	"k8s.io/apimachinery/pkg/types"
 	machinerytypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
 	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/cache"
 	watchtools "k8s.io/client-go/tools/watch"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
 	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
@@ -66,6 +80,12 @@ type DefaultExtensionManager struct {
 	// Reconcilers is the list of Eirini Reconcilers
 	Reconcilers []Reconciler
 
+	// Validators is the list of Eirini Validators that will be registered by the Manager
+	Validators []Validator
+
+	// ResourceExtensions is the list of the Extensions for resources other than pods that will be registered by the Manager
+	ResourceExtensions []ResourceExtension
+
 	// KubeManager is the kubernetes manager object which is setted up by the Manager
 	KubeManager manager.Manager
 
@@ -84,15 +104,32 @@ type DefaultExtensionManager struct {
 	// Credsgen is the credential generator implementation used for generating certificates
 	Credsgen credsgen.Generator
 
+	// Discovery is the discovery client used to detect the API versions served by the cluster
+	Discovery discovery.DiscoveryInterface
+
 	// Options are the manager options
 	Options ManagerOptions
 
 	kubeConnection *rest.Config
 	kubeClient     corev1client.CoreV1Interface
+	dynamicClient  dynamic.Interface
 
 	stopChannel chan struct{}
 
-	watcher watch.Interface
+	watcher        watch.Interface
+	watcherStopped bool
+	watcherMutex   sync.Mutex
+	watcherQueues  []*watcherQueue
+	podCheckpoint  *watchCheckpoint
+	informerStop   chan struct{}
+	podLister      corelisters.PodLister
+
+	readinessChecks []healthCheck
+	livenessChecks  []healthCheck
+
+	// registered and watchFailed are set atomically, as they are read by the health probes
+	registered  int32
+	watchFailed int32
 }
 
 // ManagerOptions represent the Runtime manager options
@@ -117,9 +154,29 @@ type ManagerOptions struct {
 	Logger *zap.SugaredLogger
 
 	// FailurePolicy default failure policy for the webhook server.  Optional, defaults to fail
-	FailurePolicy *admissionregistrationv1beta1.FailurePolicyType
+	FailurePolicy *admissionregistrationv1.FailurePolicyType
+
+	// SideEffects declares the side effects of the webhooks. Optional, defaults to None
+	SideEffects *admissionregistrationv1.SideEffectClass
+
+	// WebhookTimeoutSeconds is the time the kube api server waits for a webhook response. Optional, defaults to 10 seconds
+	WebhookTimeoutSeconds *int32
+
+	// ExtensionTimeout is the time an Extension is given to handle an admission request. Past it, the request
+	// is allowed or rejected according to the failure policy. Optional, no deadline is enforced if omitted
+	ExtensionTimeout time.Duration
+
+	// MatchPolicy defines how the webhook rules are matched against the incoming requests. Optional, defaults to Equivalent
+	MatchPolicy *admissionregistrationv1.MatchPolicyType
 
-	// FilterEiriniApps enables or disables Eirini apps filters.  Optional, defaults to true
+	// DecodeErrorPolicy is the policy for requests whose object can't be decoded. Optional, defaults to Reject
+	DecodeErrorPolicy DecodeErrorPolicy
+
+	// PatchConflictPolicy is the policy for extensions of a chain patching the same paths. Optional, defaults to Log
+	PatchConflictPolicy PatchConflictPolicy
+
+	// FilterEiriniApps enables or disables Eirini apps filters on the pod webhooks and watchers.  Optional, defaults to true.
+	// The webhooks of the ResourceExtensions aren't filtered, unless their AdmissionOptions set FilterEiriniApps
 	FilterEiriniApps *bool
 
 	// OperatorFingerprint is a unique string identifiying the Manager.  Optional, defaults to eirini-x
@@ -134,15 +191,92 @@ type ManagerOptions struct {
 	// SetupCertificate enables or disables automatic certificate generation. Defaults to true
 	SetupCertificate *bool
 
+	// CertificateRenewBefore is the time before their expiry when the webhook certificates are regenerated.
+	// Optional, defaults to DefaultCertificateRenewBefore
+	CertificateRenewBefore time.Duration
+
+	// CertificateCheckInterval is the interval between two checks of the webhook certificates expiry.
+	// Optional, defaults to DefaultCertificateCheckInterval
+	CertificateCheckInterval time.Duration
+
+	// ExtraSANs are SubjectAltNames added to the generated webhook server certificate, besides the Host
+	// or the service DNS names. Changing them regenerates the certificate. Optional
+	ExtraSANs []string
+
+	// ExternalCertificate makes the webhook server use certificates issued by a third party, e.g. cert-manager,
+	// instead of generating them. Optional, SetupCertificate is ignored if set
+	ExternalCertificate *ExternalCertificate
+
+	// CleanupOnStop unregisters the Extensions when the Manager stops, see UnregisterExtensions.
+	// Meant for single replica deployments, as it removes the webhooks of all the replicas: it is ignored
+	// if LeaderElection is set. Optional, defaults to false
+	CleanupOnStop bool
+
+	// LeaderElection runs the Reconcilers and the Watchers only on the replica elected leader, while every replica
+	// serves the webhooks. Optional, defaults to false
+	LeaderElection bool
+
+	// LeaderElectionNamespace is the namespace of the leader election lock. Optional when running in a cluster,
+	// defaults to the namespace of the extensions
+	LeaderElectionNamespace string
+
+	// LeaderElectionID is the name of the leader election lock. Optional, defaults to OperatorFingerprint
+	LeaderElectionID string
+
+	// LeaseDuration is the time the replicas wait before taking over the leadership. Optional, defaults to 15 seconds
+	LeaseDuration *time.Duration
+
+	// RenewDeadline is the time the leader retries renewing the leadership before giving it up. Optional, defaults to 10 seconds
+	RenewDeadline *time.Duration
+
+	// RetryPeriod is the time the replicas wait between two attempts to take the leadership. Optional, defaults to 2 seconds
+	RetryPeriod *time.Duration
+
+	// MetricsBindAddress is the TCP address serving the Prometheus metrics on /metrics. Optional, defaults to
+	// DefaultMetricsBindAddress, and "0" disables the metrics. The metrics used to be disabled by default:
+	// set it to "0" if another process of the pod listens on the port 8080
+	MetricsBindAddress string
+
+	// HealthProbeBindAddress is the TCP address serving the readiness and liveness probes on /readyz and /healthz,
+	// e.g. ":8081". Optional, the probes are disabled if omitted
+	HealthProbeBindAddress string
+
 	// ServiceName registers the Extension as a MutatingWebhook reachable by a service
 	ServiceName string
 
 	// WebhookNamespace, when ServiceName is supplied, a WebhookNamespace is required to indicate in which namespace the webhook service runs on
 	WebhookNamespace string
 
+	// ServiceAccountName is the service account the extensions run as, in the WebhookNamespace. The manifests
+	// rendered by RenderManifests bind it to the roles of the Manager. Optional, defaults to OperatorFingerprint
+	ServiceAccountName string
+
+	// WatcherQueue makes the Watchers handle their events from bounded queues, each with its own workers, so that
+	// a slow Watcher doesn't hold back the others. Optional, the events are handled synchronously if omitted
+	WatcherQueue *WatcherQueueOptions
+
+	// CheckpointStore persists the ResourceVersion the watches got to, which they resume from after a restart,
+	// e.g. NewConfigMapCheckpointStore. The ResourceVersion of an event is saved once the Watchers handled it
+	// and the events before it, or their queues dropped it: the events dropped by WatcherQueuePolicyDropOldest
+	// and WatcherQueuePolicyCoalesce aren't received again. Optional, the watches start from the current
+	// ResourceVersion if omitted
+	CheckpointStore CheckpointStore
+
+	// CheckpointInterval is the interval between two saves of the checkpoints. Optional, defaults to DefaultCheckpointInterval
+	CheckpointInterval time.Duration
+
 	// WatcherStartRV is the starting ResourceVersion of the PodList which is being watched (see Kubernetes #74022).
 	// If omitted, it will start watching from the current RV.
 	WatcherStartRV string
+
+	// WatcherMode is how the pods are watched. With WatcherModeInformer, the Watchers receive the events of a
+	// shared informer, each in its own goroutine, and WatcherQueue, CheckpointStore and WatcherStartRV don't
+	// apply to the pods. Optional, defaults to WatcherModeWatch
+	WatcherMode WatcherMode
+
+	// InformerResyncPeriod is the period at which the informer of WatcherModeInformer passes all the pods of its
+	// cache to the Watchers again, as updates. Optional, the pods aren't resynced if omitted
+	InformerResyncPeriod time.Duration
 }
 
 // Config controls the behaviour of different controllers
@@ -178,7 +312,7 @@ func NewManager(opts ManagerOptions) Manager {
 	}
 
 	if opts.FailurePolicy == nil {
-		failurePolicy := admissionregistrationv1beta1.Fail
+		failurePolicy := admissionregistrationv1.Fail
 		opts.FailurePolicy = &failurePolicy
 	}
 
@@ -186,10 +320,22 @@ func NewManager(opts ManagerOptions) Manager {
 		opts.OperatorFingerprint = "eirini-x"
 	}
 
+	if len(opts.LeaderElectionID) == 0 {
+		opts.LeaderElectionID = opts.OperatorFingerprint
+	}
+
+	if len(opts.ServiceAccountName) == 0 {
+		opts.ServiceAccountName = opts.OperatorFingerprint
+	}
+
 	if len(opts.SetupCertificateName) == 0 {
 		opts.SetupCertificateName = opts.getSetupCertificateName()
 	}
 
+	if len(opts.MetricsBindAddress) == 0 {
+		opts.MetricsBindAddress = DefaultMetricsBindAddress
+	}
+
 	if opts.FilterEiriniApps == nil {
 		filterEiriniApps := true
 		opts.FilterEiriniApps = &filterEiriniApps
@@ -209,11 +355,20 @@ func NewManager(opts ManagerOptions) Manager {
 }
 
 // AddExtension adds an Eirini extension to the manager.
-// It accepts Eirinix.Watcher, Eirinix.Reconciler and Eirinix.Extension types.
+// It accepts Eirinix.Watcher, Eirinix.Reconciler, Eirinix.Validator, Eirinix.Extension,
+// Eirinix.ResourceExtension, Eirinix.StatefulSetExtension and Eirinix.JobExtension types.
 func (m *DefaultExtensionManager) AddExtension(v interface{}) error {
 	switch v.(type) {
 	case Extension:
 		m.Extensions = append(m.Extensions, v.(Extension))
+	case ResourceExtension:
+		m.ResourceExtensions = append(m.ResourceExtensions, v.(ResourceExtension))
+	case StatefulSetExtension:
+		m.ResourceExtensions = append(m.ResourceExtensions, NewStatefulSetExtension(v.(StatefulSetExtension)))
+	case JobExtension:
+		m.ResourceExtensions = append(m.ResourceExtensions, NewJobExtension(v.(JobExtension)))
+	case Validator:
+		m.AddValidator(v.(Validator))
 	case Watcher:
 		m.AddWatcher(v.(Watcher))
 	case Reconciler:
@@ -229,6 +384,11 @@ func (m *DefaultExtensionManager) ListExtensions() []Extension {
 	return m.Extensions
 }
 
+// ListResourceExtensions returns the list of the ResourceExtensions added to the Manager
+func (m *DefaultExtensionManager) ListResourceExtensions() []ResourceExtension {
+	return m.ResourceExtensions
+}
+
 // AddWatcher adds an Erini watcher Extension to the manager
 func (m *DefaultExtensionManager) AddWatcher(w Watcher) {
 	m.Watchers = append(m.Watchers, w)
@@ -249,6 +409,16 @@ func (m *DefaultExtensionManager) ListReconcilers() []Reconciler {
 	return m.Reconcilers
 }
 
+// AddValidator adds an Erini validator Extension to the manager
+func (m *DefaultExtensionManager) AddValidator(v Validator) {
+	m.Validators = append(m.Validators, v)
+}
+
+// ListValidators returns the list of the Validators added to the Manager
+func (m *DefaultExtensionManager) ListValidators() []Validator {
+	return m.Validators
+}
+
 // GetContext returns the context which can be used by Extensions and Reconcilers to perform
 // background requests
 func (m *DefaultExtensionManager) GetContext() context.Context {
@@ -288,11 +458,29 @@ func (m *DefaultExtensionManager) PatchFromPod(req admission.Request, pod *corev
 	return admission.PatchResponseFromRaw(req.Object.Raw, marshaledPod)
 }
 
+// PatchFromObject returns the patch between the object of the request and the given one
+func (m *DefaultExtensionManager) PatchFromObject(req admission.Request, obj runtime.Object) admission.Response {
+	marshaledObject, err := json.Marshal(obj)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+
+	return admission.PatchResponseFromRaw(req.Object.Raw, marshaledObject)
+}
+
 // GenWatcher generates a watcher from a corev1client interface
 func (m *DefaultExtensionManager) GenWatcher(client corev1client.CoreV1Interface) (watch.Interface, error) {
-	podInterface := client.Pods(m.Options.Namespace)
+	return m.genPodWatcher(client, m.Options.WatcherStartRV, nil)
+}
 
-	startResourceVersion := m.Options.WatcherStartRV
+// genPodWatcher generates a watcher of the pods starting from the given ResourceVersion, or from the current one
+// if it's empty, and tracking its events in the checkpoint
+func (m *DefaultExtensionManager) genPodWatcher(client corev1client.CoreV1Interface, startResourceVersion string, checkpoint *watchCheckpoint) (watch.Interface, error) {
+	podInterface := client.Pods(m.Options.Namespace)
+	labelSelector, fieldSelector, err := m.podSelectors()
+	if err != nil {
+		return nil, err
+	}
 
 	if startResourceVersion == "" {
 		lw := cache.NewListWatchFromClient(client.RESTClient(), "pods", m.Options.Namespace, fields.Everything())
@@ -309,18 +497,35 @@ func (m *DefaultExtensionManager) GenWatcher(client corev1client.CoreV1Interface
 		startResourceVersion = metaObj.GetResourceVersion()
 	}
 
+	ctx := m.Context
 	return watchtools.NewRetryWatcher(startResourceVersion, &cache.ListWatch{
 		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
 			options.Watch = true
+			options.LabelSelector = labelSelector.String()
+			options.FieldSelector = fieldSelector.String()
+			options.AllowWatchBookmarks = checkpoint != nil
 
-			if m.Options.FilterEiriniApps != nil && *m.Options.FilterEiriniApps {
-				options.LabelSelector = LabelSourceType + "=APP"
+			w, err := podInterface.Watch(ctx, options)
+			if err != nil {
+				return nil, err
 			}
-
-			return podInterface.Watch(m.Context, options)
+			return checkpoint.track(w), nil
 		}})
 }
 
+// podSelectors returns the selectors of the pods the Watchers receive the events of
+func (m *DefaultExtensionManager) podSelectors() (labels.Selector, fields.Selector, error) {
+	labelSelector, fieldSelector := commonSelector(m.podWatchers())
+	if m.Options.FilterEiriniApps != nil && *m.Options.FilterEiriniApps {
+		eiriniApps, err := labels.NewRequirement(LabelSourceType, selection.Equals, []string{"APP"})
+		if err != nil {
+			return nil, nil, err
+		}
+		labelSelector = withLabelRequirement(labelSelector, *eiriniApps)
+	}
+	return labelSelector, fieldSelector, nil
+}
+
 // GetLogger returns the Manager injected logger
 func (m *DefaultExtensionManager) GetLogger() *zap.SugaredLogger {
 	return m.Logger
@@ -349,8 +554,19 @@ func (m *DefaultExtensionManager) GenWebHookServer() {
 
 	//disableConfigInstaller := true
 
-	m.WebhookConfig = NewWebhookConfig(
-		m.KubeManager.GetClient(),
+	m.WebhookConfig = m.newWebhookConfig(m.KubeManager.GetClient())
+
+	hookServer := m.KubeManager.GetWebhookServer()
+	hookServer.CertDir = m.WebhookConfig.CertDir
+	hookServer.Port = int(m.Options.Port)
+	hookServer.Host = m.Options.Host
+	m.WebhookServer = hookServer
+}
+
+// newWebhookConfig returns the webhook configuration of the Manager options, using the client c
+func (m *DefaultExtensionManager) newWebhookConfig(c client.Client) *WebhookConfig {
+	config := NewWebhookConfig(
+		c,
 		&Config{
 			CtxTimeOut:        10 * time.Second,
 			Namespace:         m.Options.Namespace,
@@ -363,12 +579,14 @@ func (m *DefaultExtensionManager) GenWebHookServer() {
 		m.Options.SetupCertificateName,
 		m.Options.ServiceName,
 		m.Options.WebhookNamespace)
-
-	hookServer := m.KubeManager.GetWebhookServer()
-	hookServer.CertDir = m.WebhookConfig.CertDir
-	hookServer.Port = int(m.Options.Port)
-	hookServer.Host = m.Options.Host
-	m.WebhookServer = hookServer
+	config.ValidatingConfigName = fmt.Sprintf("%s-validating-hook", m.Options.OperatorFingerprint)
+	config.RenewBefore = m.Options.CertificateRenewBefore
+	config.ExtraSANs = m.Options.ExtraSANs
+	config.OperatorFingerprint = m.Options.OperatorFingerprint
+	if m.Options.ExternalCertificate != nil && m.Options.ExternalCertificate.Dir != "" {
+		config.CertDir = m.Options.ExternalCertificate.Dir
+	}
+	return config
 }
 
 // OperatorSetup prepares the webhook server, generates certificates and configuration.
@@ -389,11 +607,123 @@ func (m *DefaultExtensionManager) OperatorSetup() error {
 		}
 	}
 
-	if *m.Options.SetupCertificate {
+	if m.Options.ExternalCertificate != nil {
+		if _, err := m.WebhookConfig.loadExternalCertificate(m.Context, m.Options.ExternalCertificate); err != nil {
+			return errors.Wrap(err, "loading the external webhook server certificate")
+		}
+		if err := m.KubeManager.Add(replicaRunnable(m.watchExternalCertificate)); err != nil {
+			return errors.Wrap(err, "adding the external webhook server certificate watch")
+		}
+	} else if *m.Options.SetupCertificate {
 		if err := m.WebhookConfig.setupCertificate(m.Context); err != nil {
 			return errors.Wrap(err, "setting up the webhook server certificate")
 		}
+		if err := m.KubeManager.Add(replicaRunnable(m.rotateCertificates)); err != nil {
+			return errors.Wrap(err, "adding the webhook server certificate rotation")
+		}
+	}
+
+	if m.Options.HealthProbeBindAddress != "" {
+		if err := m.setupHealthChecks(); err != nil {
+			return errors.Wrap(err, "setting up the health probes")
+		}
+	}
+	return nil
+}
+
+// rotateCertificates checks periodically the expiry of the webhook server certificates, until stop is closed
+func (m *DefaultExtensionManager) rotateCertificates(stop <-chan struct{}) error {
+	interval := m.Options.CertificateCheckInterval
+	if interval == 0 {
+		interval = DefaultCertificateCheckInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return nil
+		case <-ticker.C:
+			if err := m.RotateCertificate(); err != nil {
+				m.Logger.Errorf("Failed rotating the webhook server certificate: %v", err)
+			}
+		}
+	}
+}
+
+// RotateCertificate regenerates the webhook server certificates if they are about to expire.
+// The CA bundle of the registered webhooks is updated before the webhook server reloads the new certificate.
+func (m *DefaultExtensionManager) RotateCertificate() error {
+	renewed, err := m.WebhookConfig.renewCertificate(m.Context)
+	if err != nil {
+		return errors.Wrap(err, "renewing the webhook server certificate")
+	}
+	if !renewed {
+		return nil
+	}
+
+	if err := m.publishCABundle(); err != nil {
+		return err
+	}
+
+	if err := m.WebhookConfig.writeSecretFiles(); err != nil {
+		return errors.Wrap(err, "writing webhook certificate files to disk")
+	}
+	m.Logger.Info("Rotated the webhook server certificate")
+	return nil
+}
+
+// publishCABundle updates the CA bundle of the registered webhooks
+func (m *DefaultExtensionManager) publishCABundle() error {
+	if m.Options.RegisterWebHook != nil && !*m.Options.RegisterWebHook {
+		return nil
+	}
+	if err := m.WebhookConfig.updateCABundle(m.Context, "MutatingWebhookConfiguration", m.WebhookConfig.ConfigName); err != nil {
+		return err
+	}
+	return m.WebhookConfig.updateCABundle(m.Context, "ValidatingWebhookConfiguration", m.WebhookConfig.ValidatingConfigName)
+}
+
+// watchExternalCertificate reads periodically the external certificates, until stop is closed
+func (m *DefaultExtensionManager) watchExternalCertificate(stop <-chan struct{}) error {
+	interval := m.Options.ExternalCertificate.CheckInterval
+	if interval == 0 {
+		interval = DefaultExternalCertificateCheckInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return nil
+		case <-ticker.C:
+			if err := m.ReloadExternalCertificate(); err != nil {
+				m.Logger.Errorf("Failed reloading the external webhook server certificate: %v", err)
+			}
+		}
+	}
+}
+
+// ReloadExternalCertificate reads the external certificates, and publishes the CA bundle to the
+// registered webhooks if it changed
+func (m *DefaultExtensionManager) ReloadExternalCertificate() error {
+	caCert := m.WebhookConfig.CaCertificate
+	changed, err := m.WebhookConfig.loadExternalCertificate(m.Context, m.Options.ExternalCertificate)
+	if err != nil {
+		return errors.Wrap(err, "loading the external webhook server certificate")
+	}
+	if !changed {
+		return nil
+	}
+
+	if !bytes.Equal(caCert, m.WebhookConfig.CaCertificate) {
+		if err := m.publishCABundle(); err != nil {
+			return err
+		}
 	}
+	m.Logger.Info("Reloaded the external webhook server certificate")
 	return nil
 }
 
@@ -468,26 +798,23 @@ func (m *DefaultExtensionManager) RegisterExtensions() error {
 
 // LoadExtensions generates and register webhooks from the Extensions added to the Manager
 func (m *DefaultExtensionManager) LoadExtensions() error {
-
-	var webhooks []MutatingWebhook
-	for k, e := range m.Extensions {
-		w := NewWebhook(e, m)
-		err := w.RegisterAdmissionWebHook(m.WebhookServer,
-			WebhookOptions{
-				ID:             strconv.Itoa(k),
-				Manager:        m.KubeManager,
-				ManagerOptions: m.Options,
-			})
-		if err != nil {
-			return err
-		}
-		webhooks = append(webhooks, w)
+	webhooks, validatingWebhooks, err := m.generateWebhooks(m.WebhookServer)
+	if err != nil {
+		return err
 	}
 
 	if m.Options.RegisterWebHook == nil || m.Options.RegisterWebHook != nil && *m.Options.RegisterWebHook {
+		version, err := m.AdmissionRegistrationVersion()
+		if err != nil {
+			return errors.Wrap(err, "detecting the admissionregistration api version")
+		}
+		m.WebhookConfig.AdmissionRegistrationVersion = version
 		if err := m.WebhookConfig.registerWebhooks(m.Context, webhooks); err != nil {
 			return errors.Wrap(err, "generating the webhook server configuration")
 		}
+		if err := m.WebhookConfig.registerValidatingWebhooks(m.Context, validatingWebhooks); err != nil {
+			return errors.Wrap(err, "generating the validating webhook server configuration")
+		}
 	}
 
 	for _, r := range m.Reconcilers {
@@ -495,9 +822,93 @@ func (m *DefaultExtensionManager) LoadExtensions() error {
 			return err
 		}
 	}
+
+	atomic.StoreInt32(&m.registered, 1)
 	return nil
 }
 
+// generateWebhooks generates the webhooks of the Extensions added to the Manager, and registers them to the server
+func (m *DefaultExtensionManager) generateWebhooks(server *webhook.Server) ([]MutatingWebhook, []ValidatingWebhook, error) {
+	var webhooks []MutatingWebhook
+	ids := map[string]bool{}
+	for k, e := range m.Extensions {
+		id, err := extensionID(k, e)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		w := NewWebhook(e, m)
+		if err := m.registerWebhook(server, w, e, id, ids); err != nil {
+			return nil, nil, err
+		}
+		webhooks = append(webhooks, w)
+	}
+
+	for k, e := range m.ResourceExtensions {
+		id, err := extensionID(k, unwrapExtension(e))
+		if err != nil {
+			return nil, nil, err
+		}
+		if _, named := unwrapExtension(e).(Named); !named {
+			id = fmt.Sprintf("%s-%s", strings.ToLower(e.GroupVersionKind().Kind), id)
+		}
+
+		w := NewResourceWebhook(e, m)
+		if err := m.registerWebhook(server, w, e, id, ids); err != nil {
+			return nil, nil, err
+		}
+		webhooks = append(webhooks, w)
+	}
+
+	var validatingWebhooks []ValidatingWebhook
+	for k, v := range m.Validators {
+		id, err := extensionID(k, v)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		w := NewValidatingWebhook(v, m)
+		if err := m.registerWebhook(server, w, v, "validate-"+id, ids); err != nil {
+			return nil, nil, err
+		}
+		validatingWebhooks = append(validatingWebhooks, w)
+	}
+	return webhooks, validatingWebhooks, nil
+}
+
+// registerWebhook registers the webhook generated from the extension e to the webhook server.
+// ids are the webhook IDs already in use.
+func (m *DefaultExtensionManager) registerWebhook(server *webhook.Server, w AdmissionWebhook, e interface{}, id string, ids map[string]bool) error {
+	if ids[id] {
+		return fmt.Errorf("Duplicate extension name %s", id)
+	}
+	ids[id] = true
+
+	opts := WebhookOptions{
+		ID:             id,
+		Manager:        m.KubeManager,
+		ManagerOptions: m.Options,
+	}
+	if p, ok := unwrapExtension(e).(WebhookOptionsProvider); ok {
+		opts.AdmissionOptions = p.AdmissionOptions()
+	}
+	return w.RegisterAdmissionWebHook(server, opts)
+}
+
+// extensionID returns the ID of the webhook generated from the Extension.
+// Named Extensions use their name, the others their position in the Manager.
+func extensionID(index int, e interface{}) (string, error) {
+	n, ok := e.(Named)
+	if !ok {
+		return strconv.Itoa(index), nil
+	}
+	name := n.Name()
+	if errs := validation.IsDNS1123Label(name); len(errs) > 0 {
+		return "", fmt.Errorf("Invalid extension name %q: %s", name, strings.Join(errs, ", "))
+	}
+	return name, nil
+}
+
 func (m *DefaultExtensionManager) generateManager() error {
 	m.Credsgen = inmemorycredgen.NewInMemoryGenerator(m.Logger)
 	kubeConn, err := m.GetKubeConnection()
@@ -508,11 +919,17 @@ func (m *DefaultExtensionManager) generateManager() error {
 	mgr, err := manager.New(
 		kubeConn,
 		manager.Options{
-			Namespace:          m.Options.Namespace,
-			MetricsBindAddress: "0",
-			LeaderElection:     false,
-			Port:               int(m.Options.Port),
-			Host:               m.Options.Host,
+			Namespace:               m.Options.Namespace,
+			MetricsBindAddress:      m.Options.MetricsBindAddress,
+			HealthProbeBindAddress:  m.Options.HealthProbeBindAddress,
+			LeaderElection:          m.Options.LeaderElection,
+			LeaderElectionNamespace: m.Options.LeaderElectionNamespace,
+			LeaderElectionID:        m.Options.LeaderElectionID,
+			LeaseDuration:           m.Options.LeaseDuration,
+			RenewDeadline:           m.Options.RenewDeadline,
+			RetryPeriod:             m.Options.RetryPeriod,
+			Port:                    int(m.Options.Port),
+			Host:                    m.Options.Host,
 		})
 	if err != nil {
 		return err
@@ -520,14 +937,60 @@ func (m *DefaultExtensionManager) generateManager() error {
 
 	m.KubeManager = mgr
 
+	discoveryClient, err := discovery.NewDiscoveryClientForConfig(kubeConn)
+	if err != nil {
+		return errors.Wrap(err, "Failed creating the discovery client")
+	}
+	m.Discovery = discoveryClient
+
 	return nil
 }
 
-// HandleEvent handles a watcher event.
-// It propagates the event to all the registered watchers.
+// AdmissionRegistrationVersion returns the admissionregistration.k8s.io version used to register the webhooks.
+// It prefers v1, and falls back to v1beta1 only if the cluster doesn't serve v1 yet.
+// Without a discovery client v1 is assumed.
+func (m *DefaultExtensionManager) AdmissionRegistrationVersion() (string, error) {
+	if m.Discovery == nil {
+		return admissionregistrationv1.SchemeGroupVersion.Version, nil
+	}
+
+	groups, err := m.Discovery.ServerGroups()
+	if err != nil {
+		return "", err
+	}
+
+	served := map[string]bool{}
+	for _, g := range groups.Groups {
+		if g.Name != admissionregistrationv1.GroupName {
+			continue
+		}
+		for _, v := range g.Versions {
+			served[v.Version] = true
+		}
+	}
+
+	switch {
+	case served[admissionregistrationv1.SchemeGroupVersion.Version]:
+		return admissionregistrationv1.SchemeGroupVersion.Version, nil
+	case served[admissionregistrationv1beta1.SchemeGroupVersion.Version]:
+		return admissionregistrationv1beta1.SchemeGroupVersion.Version, nil
+	}
+	return "", errors.New("The cluster doesn't serve the admissionregistration.k8s.io API group")
+}
+
+// HandleEvent handles a pod watcher event.
+// It propagates the event to all the registered watchers selecting it, but the ResourceWatchers.
 func (m *DefaultExtensionManager) HandleEvent(e watch.Event) {
-	for _, w := range m.Watchers {
-		w.Handle(m, e)
+	m.handleEvent(e, nil)
+}
+
+// handleEvent propagates the event to the watchers selecting it, recording in the tracked event the ones handling it
+func (m *DefaultExtensionManager) handleEvent(e watch.Event, t *trackedEvent) {
+	for i, w := range m.Watchers {
+		if _, ok := w.(ResourceWatcher); ok || !watcherSelects(w, e) {
+			continue
+		}
+		m.deliverEvent(i, w, e, t)
 	}
 }
 
@@ -548,41 +1011,234 @@ func (m *DefaultExtensionManager) Watch() error {
 	if err != nil {
 		return err
 	}
-	watcher, err := m.GenWatcher(client)
+	if m.Context == nil {
+		m.Context = ctxlog.NewManagerContext(m.Logger)
+	}
+	startResourceVersion := m.Options.WatcherStartRV
+	if m.podCheckpoint != nil {
+		startResourceVersion = m.podCheckpoint.resume()
+	}
+	watcher, err := m.genPodWatcher(client, startResourceVersion, m.podCheckpoint)
 	if err != nil {
 		return err
 	}
-	m.Context = ctxlog.NewManagerContext(m.Logger)
 
+	m.watcherMutex.Lock()
+	if m.watcher != nil {
+		watcherRestarts.Inc()
+	}
 	m.watcher = watcher
+	if m.watcherStopped {
+		watcher.Stop()
+	}
+	m.watcherMutex.Unlock()
 
-	m.ReadWatcherEvent(watcher)
+	for e := range watcher.ResultChan() {
+		t := m.podCheckpoint.dispatch(e)
+		m.handleEvent(e, t)
+		t.handled()
+	}
 
 	return &WatcherChannelClosedError{"Watcher channel closed"}
 }
 
+// watchLoop is a watch run by RunWatchers
+type watchLoop struct {
+	name  string
+	watch func() error
+	stop  func()
+}
+
+// RunWatchers runs the Watch loop of the pods, and one loop per resource and selectors the ResourceWatchers
+// asked for, until stop is closed. A watch is started again with an exponential backoff when its channel closes,
+// while the other errors, e.g. failing to connect to the cluster, stop all the watches and are returned.
+func (m *DefaultExtensionManager) RunWatchers(stop <-chan struct{}) error {
+	watches, err := m.resourceWatches()
+	if err != nil {
+		atomic.StoreInt32(&m.watchFailed, 1)
+		return err
+	}
+
+	// The loops share the context and the clients, which are set up before they start
+	if m.Context == nil {
+		m.Context = ctxlog.NewManagerContext(m.Logger)
+	}
+	if len(watches) > 0 {
+		if _, err := m.GetDynamicClient(); err != nil {
+			atomic.StoreInt32(&m.watchFailed, 1)
+			return errors.Wrap(err, "watching the resources")
+		}
+	}
+
+	m.watcherMutex.Lock()
+	m.watcherStopped = false
+	m.watcherMutex.Unlock()
+
+	// The watches resume from their checkpoints, the pods one from WatcherStartRV if it has none
+	var checkpoints []*watchCheckpoint
+	var loops []watchLoop
+	m.podCheckpoint = nil
+	if len(m.podWatchers()) > 0 && m.Options.WatcherMode == WatcherModeInformer {
+		loops = append(loops, watchLoop{name: "pods", watch: m.runPodInformer, stop: m.stopPodInformer})
+	} else if len(m.podWatchers()) > 0 {
+		m.podCheckpoint = m.loadCheckpoint("pods")
+		if m.podCheckpoint != nil && m.podCheckpoint.resourceVersion == "" {
+			m.podCheckpoint.resourceVersion = m.Options.WatcherStartRV
+		}
+		checkpoints = append(checkpoints, m.podCheckpoint)
+		loops = append(loops, watchLoop{name: "pods", watch: m.Watch, stop: m.stopWatcher})
+	}
+	for _, w := range watches {
+		w := w
+		w.checkpoint = m.loadCheckpoint(w.key.checkpointKey())
+		checkpoints = append(checkpoints, w.checkpoint)
+		loops = append(loops, watchLoop{name: w.key.String(), watch: func() error { return m.watchResource(w) }, stop: w.stop})
+	}
+
+	m.startWatcherQueues()
+	defer func() { m.watcherQueues = nil }()
+
+	// The first error stops the other loops
+	stopLoops := make(chan struct{})
+	var stopOnce sync.Once
+	stopAll := func() {
+		stopOnce.Do(func() {
+			close(stopLoops)
+			m.closeWatcherQueues()
+		})
+	}
+	defer stopAll()
+	go func() {
+		select {
+		case <-stop:
+			stopAll()
+		case <-stopLoops:
+		}
+	}()
+
+	if m.Options.CheckpointStore != nil {
+		saved := make(chan struct{})
+		defer func() { <-saved }()
+		go func() {
+			m.saveCheckpoints(stopLoops, checkpoints)
+			close(saved)
+		}()
+	}
+
+	errs := make(chan error, len(loops))
+	for _, l := range loops {
+		go func(l watchLoop) {
+			errs <- m.runWatchLoop(stopLoops, l)
+		}(l)
+	}
+
+	var result error
+	for range loops {
+		if err := <-errs; err != nil && result == nil {
+			result = err
+			stopAll()
+		}
+	}
+	return result
+}
+
+// runWatchLoop runs the watch of the loop until stop is closed, restarting it with an exponential backoff
+// when its channel closes
+func (m *DefaultExtensionManager) runWatchLoop(stop <-chan struct{}, l watchLoop) error {
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-stop:
+			l.stop()
+		case <-done:
+		}
+	}()
+
+	backoff := watcherBackoff()
+	for {
+		started := time.Now()
+		err := l.watch()
+		select {
+		case <-stop:
+			return nil
+		default:
+		}
+		if _, closed := err.(*WatcherChannelClosedError); !closed {
+			atomic.StoreInt32(&m.watchFailed, 1)
+			return errors.Wrapf(err, "watching the %s", l.name)
+		}
+
+		// A watch which ran for a while is restarted right away
+		if time.Since(started) > backoff.Cap {
+			backoff = watcherBackoff()
+		}
+		delay := backoff.Step()
+		m.Logger.Warnf("The watch of the %s closed, restarting it in %s", l.name, delay)
+		select {
+		case <-stop:
+			return nil
+		case <-time.After(delay):
+		}
+	}
+}
+
+// watcherBackoff returns the backoff between the restarts of the watch
+func watcherBackoff() wait.Backoff {
+	return wait.Backoff{
+		Duration: 100 * time.Millisecond,
+		Factor:   2,
+		Jitter:   0.1,
+		Steps:    math.MaxInt32,
+		Cap:      time.Minute,
+	}
+}
+
+// stopWatcher stops the current watch, which makes Watch return, and the watches started afterwards
+func (m *DefaultExtensionManager) stopWatcher() {
+	m.watcherMutex.Lock()
+	defer m.watcherMutex.Unlock()
+	m.watcherStopped = true
+	if m.watcher != nil {
+		m.watcher.Stop()
+	}
+}
+
 // Start starts the Manager infinite loop, and returns an error on failure
 func (m *DefaultExtensionManager) Start() error {
 	defer m.Logger.Sync()
 
-	if len(m.Watchers) >= 0 {
-		go m.Watch()
-	}
-
 	if err := m.RegisterExtensions(); err != nil {
 		return err
 	}
 
-	return m.KubeManager.Start(m.stopChannel)
+	// The watchers run only on the leader, see LeaderElection, and their errors stop the Manager
+	if len(m.Watchers) > 0 {
+		if err := m.KubeManager.Add(manager.RunnableFunc(m.RunWatchers)); err != nil {
+			return errors.Wrap(err, "adding the watchers")
+		}
+	}
+
+	err := m.KubeManager.Start(m.stopChannel)
+	// With LeaderElection, the other replicas keep serving the webhooks, e.g. when this one lost the leadership
+	if m.Options.CleanupOnStop && m.Options.LeaderElection {
+		m.Logger.Warn("Not unregistering the extensions on stop, as LeaderElection is enabled")
+	} else if m.Options.CleanupOnStop {
+		if cleanupErr := m.UnregisterExtensions(); cleanupErr != nil {
+			m.Logger.Errorf("Failed unregistering the extensions: %v", cleanupErr)
+			if err == nil {
+				err = cleanupErr
+			}
+		}
+	}
+	return err
 }
 
 func (m *DefaultExtensionManager) Stop() {
 	defer m.Logger.Sync()
 
 	close(m.stopChannel)
-	if m.watcher != nil {
-		m.watcher.Stop()
-	}
+	m.stopWatcher()
 }
 
 func (o *ManagerOptions) getDefaultNamespaceLabel() string {
@@ -610,3 +1266,14 @@ func (p setLabelPatch) Data(_ runtime.Object) ([]byte, error) {
 		},
 	})
 }
+
+// replicaRunnable is a Runnable running on every replica, regardless of the leader election
+type replicaRunnable func(stop <-chan struct{}) error
+
+func (r replicaRunnable) Start(stop <-chan struct{}) error {
+	return r(stop)
+}
+
+func (r replicaRunnable) NeedLeaderElection() bool {
+	return false
+}
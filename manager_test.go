@@ -4,8 +4,13 @@ import (
 	"context"
 	"encoding/base64"
 	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	credsgen "code.cloudfoundry.org/quarks-utils/pkg/credsgen"
@@ -16,9 +21,14 @@ import (
 	cfakes "code.cloudfoundry.org/eirinix/testing/fakes"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	"github.com/phayes/freeport"
+	"github.com/pkg/errors"
 	"github.com/spf13/afero"
 
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
 	admissionregistrationv1beta1 "k8s.io/api/admissionregistration/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -27,12 +37,18 @@ import (
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/watch"
+	fakediscovery "k8s.io/client-go/discovery/fake"
 	"k8s.io/client-go/kubernetes/scheme"
+	clienttesting "k8s.io/client-go/testing"
 	watchtools "k8s.io/client-go/tools/watch"
 
 	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
 	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
 	crc "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
+	crmanager "sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
 )
 
@@ -56,6 +72,13 @@ var _ = Describe("Extension Manager", func() {
 		eiriniServiceManager, _ = ServiceManager.(*DefaultExtensionManager)
 		AddToScheme(scheme.Scheme)
 		client = &cfakes.FakeClient{}
+		client.GetCalls(func(_ context.Context, nn types.NamespacedName, object runtime.Object) error {
+			// No webhook configuration is registered yet
+			if object.GetObjectKind().GroupVersionKind().Group == "admissionregistration.k8s.io" {
+				return apierrors.NewNotFound(schema.GroupResource{}, nn.Name)
+			}
+			return nil
+		})
 		restMapper := meta.NewDefaultRESTMapper([]schema.GroupVersion{})
 		restMapper.Add(schema.GroupVersionKind{Group: "", Kind: "Pod", Version: "v1"}, meta.RESTScopeNamespace)
 
@@ -87,9 +110,13 @@ var _ = Describe("Extension Manager", func() {
 			Expect(Manager.GetManagerOptions().Namespace).To(Equal("default"))
 			Expect(Manager.GetManagerOptions().Host).To(Equal("127.0.0.1"))
 			Expect(Manager.GetManagerOptions().Port).To(Equal(int32(90)))
-			defaultPolicy := admissionregistrationv1beta1.Fail
+			defaultPolicy := admissionregistrationv1.Fail
 			Expect(Manager.GetManagerOptions().FailurePolicy).To(Equal(&defaultPolicy))
 			Expect(Manager.GetManagerOptions().OperatorFingerprint).To(Equal("eirini-x"))
+			Expect(Manager.GetManagerOptions().LeaderElection).To(BeFalse())
+			Expect(Manager.GetManagerOptions().LeaderElectionID).To(Equal("eirini-x"))
+			Expect(Manager.GetManagerOptions().MetricsBindAddress).To(Equal(":8080"))
+			Expect(Manager.GetManagerOptions().ServiceAccountName).To(Equal("eirini-x"))
 			Expect(Manager.GetManagerOptions().KubeConfig).To(Equal(""))
 			Expect(Manager.GetManagerOptions().Logger).NotTo(Equal(nil))
 			Expect(*Manager.GetManagerOptions().FilterEiriniApps).To(BeTrue())
@@ -144,6 +171,23 @@ var _ = Describe("Extension Manager", func() {
 		})
 	})
 
+	It("generates the certificate for the service DNS names", func() {
+		eiriniServiceManager.Options.ExtraSANs = []string{"10.0.0.1"}
+		eiriniServiceManager.Options.SetupCertificateName = "test-service-setupcert"
+		defer os.RemoveAll(filepath.Join(os.TempDir(), "test-service-setupcert"))
+		Expect(eiriniServiceManager.OperatorSetup()).To(Succeed())
+
+		_, request := generator.GenerateCertificateArgsForCall(1)
+		Expect(request.CommonName).To(Equal("extension.cf.svc"))
+		Expect(request.AlternativeNames).To(Equal([]string{
+			"extension",
+			"extension.cf",
+			"extension.cf.svc",
+			"extension.cf.svc.cluster.local",
+			"10.0.0.1",
+		}))
+	})
+
 	It("sets the operator namespace label", func() {
 		client.UpdateCalls(func(_ context.Context, object runtime.Object, _ ...crc.UpdateOption) error {
 			ns := object.(*unstructured.Unstructured)
@@ -172,24 +216,50 @@ var _ = Describe("Extension Manager", func() {
 	})
 
 	Context("if there is a persisted cert secret already", func() {
-		BeforeEach(func() {
-			secret := &unstructured.Unstructured{
-				Object: map[string]interface{}{
-					"metadata": map[string]interface{}{
-						"name":      "eirinix",
-						"namespace": eiriniManager.Options.Namespace,
+		var (
+			secret           *unstructured.Unstructured
+			registeredConfig *unstructured.Unstructured
+			caCert           credsgen.Certificate
+			previousCA       []byte
+			persistCert      = func(expiry int) {
+				var cert credsgen.Certificate
+				var err error
+				caCert, cert, err = eirinixcatalog.Certificates(expiry, eiriniManager.Options.Host)
+				Expect(err).ToNot(HaveOccurred())
+				secret = &unstructured.Unstructured{
+					Object: map[string]interface{}{
+						"metadata": map[string]interface{}{
+							"name":      "eirinix",
+							"namespace": eiriniManager.Options.Namespace,
+						},
+						"data": map[string]interface{}{
+							"certificate":    base64.StdEncoding.EncodeToString(cert.Certificate),
+							"private_key":    base64.StdEncoding.EncodeToString(cert.PrivateKey),
+							"ca_certificate": base64.StdEncoding.EncodeToString(caCert.Certificate),
+							"ca_private_key": base64.StdEncoding.EncodeToString(caCert.PrivateKey),
+						},
 					},
-					"data": map[string]interface{}{
-						"certificate":    base64.StdEncoding.EncodeToString([]byte("the-cert")),
-						"private_key":    base64.StdEncoding.EncodeToString([]byte("the-key")),
-						"ca_certificate": base64.StdEncoding.EncodeToString([]byte("the-ca-cert")),
-						"ca_private_key": base64.StdEncoding.EncodeToString([]byte("the-ca-key")),
-					},
-				},
+				}
+				if len(previousCA) > 0 {
+					secret.Object["data"].(map[string]interface{})["previous_ca_certificate"] = base64.StdEncoding.EncodeToString(previousCA)
+				}
 			}
+		)
+
+		BeforeEach(func() {
+			previousCA = nil
+			persistCert(365)
+			registeredConfig = nil
 			client.GetCalls(func(context context.Context, nn types.NamespacedName, object runtime.Object) error {
 				switch object.(type) {
 				case *unstructured.Unstructured:
+					if object.GetObjectKind().GroupVersionKind().Kind == "MutatingWebhookConfiguration" && registeredConfig != nil {
+						registeredConfig.DeepCopyInto(object.(*unstructured.Unstructured))
+						return nil
+					}
+					if object.GetObjectKind().GroupVersionKind().Group == "admissionregistration.k8s.io" {
+						return apierrors.NewNotFound(schema.GroupResource{}, nn.Name)
+					}
 					secret.DeepCopyInto(object.(*unstructured.Unstructured))
 					return nil
 				}
@@ -198,6 +268,166 @@ var _ = Describe("Extension Manager", func() {
 
 		})
 
+		It("renews the certificates which are about to expire", func() {
+			persistCert(10)
+			Expect(eiriniManager.OperatorSetup()).To(Succeed())
+			Expect(generator.GenerateCertificateCallCount()).To(Equal(2)) // Generate CA and certificate
+			Expect(client.UpdateCallCount()).To(Equal(1))                 // Secret
+			_, object, _ := client.UpdateArgsForCall(0)
+			updated := object.(*unstructured.Unstructured)
+			Expect(updated.Object["data"]).To(HaveKeyWithValue("certificate", base64.StdEncoding.EncodeToString([]byte("thecert"))))
+		})
+
+		It("renews the certificates within the configured threshold", func() {
+			eiriniManager.Options.CertificateRenewBefore = 400 * 24 * time.Hour
+			Expect(eiriniManager.OperatorSetup()).To(Succeed())
+			Expect(generator.GenerateCertificateCallCount()).To(Equal(2))
+		})
+
+		It("renews the certificates when the SubjectAltNames change", func() {
+			eiriniManager.Options.ExtraSANs = []string{"webhook.example.org"}
+			Expect(eiriniManager.OperatorSetup()).To(Succeed())
+			Expect(generator.GenerateCertificateCallCount()).To(Equal(2))
+			_, request := generator.GenerateCertificateArgsForCall(1)
+			Expect(request.AlternativeNames).To(Equal([]string{"127.0.0.1", "webhook.example.org"}))
+		})
+
+		It("records the expiry of the certificates", func() {
+			Expect(eiriniManager.OperatorSetup()).To(Succeed())
+			families, err := metrics.Registry.Gather()
+			Expect(err).ToNot(HaveOccurred())
+			expiries := map[string]float64{}
+			for _, f := range families {
+				if f.GetName() == "eirinix_certificate_expiry_timestamp_seconds" {
+					for _, m := range f.GetMetric() {
+						expiries[m.GetLabel()[0].GetValue()] = m.GetGauge().GetValue()
+					}
+				}
+			}
+			inAYear := float64(time.Now().AddDate(0, 0, 365).Unix())
+			Expect(expiries).To(HaveKeyWithValue("certificate", BeNumerically("~", inAYear, 24*60*60)))
+			Expect(expiries).To(HaveKeyWithValue("ca", BeNumerically("~", inAYear, 24*60*60)))
+		})
+
+		It("checks the certificates periodically", func() {
+			Expect(eiriniManager.OperatorSetup()).To(Succeed())
+			Expect(manager.AddCallCount()).To(Equal(1))
+
+			// Every replica reloads the renewed certificates, not only the leader
+			runnable, ok := manager.AddArgsForCall(0).(crmanager.LeaderElectionRunnable)
+			Expect(ok).To(BeTrue())
+			Expect(runnable.NeedLeaderElection()).To(BeFalse())
+		})
+
+		It("rotates the certificates and updates the CA bundle of the registered webhooks", func() {
+			registeredConfig = &unstructured.Unstructured{Object: map[string]interface{}{
+				"metadata": map[string]interface{}{"name": "eirini-x-mutating-hook"},
+				"webhooks": []interface{}{
+					map[string]interface{}{"name": "0.eirini-x.org", "clientConfig": map[string]interface{}{"caBundle": "old"}},
+				},
+			}}
+			Expect(eiriniManager.OperatorSetup()).To(Succeed())
+			Expect(eiriniManager.RotateCertificate()).To(Succeed())
+			Expect(generator.GenerateCertificateCallCount()).To(Equal(0))
+			Expect(client.UpdateCallCount()).To(Equal(0))
+
+			eiriniManager.WebhookConfig.RenewBefore = 400 * 24 * time.Hour
+			Expect(eiriniManager.RotateCertificate()).To(Succeed())
+			Expect(generator.GenerateCertificateCallCount()).To(Equal(2))
+			Expect(client.UpdateCallCount()).To(Equal(2)) // Secret and mutating webhook configuration
+
+			_, object, _ := client.UpdateArgsForCall(0)
+			Expect(object.(*unstructured.Unstructured).Object["data"]).To(HaveKeyWithValue("previous_ca_certificate", base64.StdEncoding.EncodeToString(caCert.Certificate)))
+
+			_, object, _ = client.UpdateArgsForCall(1)
+			config := object.(*unstructured.Unstructured)
+			webhooks, _, _ := unstructured.NestedSlice(config.Object, "webhooks")
+			caBundle, _, _ := unstructured.NestedString(webhooks[0].(map[string]interface{}), "clientConfig", "caBundle")
+			decoded, err := base64.StdEncoding.DecodeString(caBundle)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(decoded)).To(ContainSubstring("thecert"))
+			Expect(string(decoded)).To(ContainSubstring(string(caCert.Certificate)))
+
+			tlsCert, err := afero.ReadFile(afero.NewOsFs(), filepath.Join(eiriniManager.WebhookConfig.CertDir, "tls.crt"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(tlsCert)).To(Equal("thecert"))
+		})
+
+		It("leaves the CA bundle of the webhooks of other operators untouched, retrying on conflicts", func() {
+			registeredConfig = &unstructured.Unstructured{Object: map[string]interface{}{
+				"metadata": map[string]interface{}{"name": "eirini-x-mutating-hook"},
+				"webhooks": []interface{}{
+					map[string]interface{}{"name": "0.eirini-x.org", "clientConfig": map[string]interface{}{"caBundle": "old"}},
+					map[string]interface{}{"name": "other.example.org", "clientConfig": map[string]interface{}{"caBundle": "theirs"}},
+				},
+			}}
+			Expect(eiriniManager.OperatorSetup()).To(Succeed())
+			client.UpdateReturnsOnCall(1, apierrors.NewConflict(schema.GroupResource{}, "eirini-x-mutating-hook", nil))
+
+			eiriniManager.WebhookConfig.RenewBefore = 400 * 24 * time.Hour
+			Expect(eiriniManager.RotateCertificate()).To(Succeed())
+			Expect(client.UpdateCallCount()).To(Equal(3)) // Secret and mutating webhook configuration, twice
+
+			_, object, _ := client.UpdateArgsForCall(2)
+			webhooks, _, _ := unstructured.NestedSlice(object.(*unstructured.Unstructured).Object, "webhooks")
+			ours, _, _ := unstructured.NestedString(webhooks[0].(map[string]interface{}), "clientConfig", "caBundle")
+			Expect(ours).ToNot(Equal("old"))
+			theirs, _, _ := unstructured.NestedString(webhooks[1].(map[string]interface{}), "clientConfig", "caBundle")
+			Expect(theirs).To(Equal("theirs"))
+		})
+
+		It("loads the certificates renewed concurrently by another replica", func() {
+			registeredConfig = &unstructured.Unstructured{Object: map[string]interface{}{
+				"metadata": map[string]interface{}{"name": "eirini-x-mutating-hook"},
+				"webhooks": []interface{}{
+					map[string]interface{}{"name": "0.eirini-x.org", "clientConfig": map[string]interface{}{"caBundle": "old"}},
+				},
+			}}
+			Expect(eiriniManager.OperatorSetup()).To(Succeed())
+			oldCA := caCert
+
+			// Another replica saves its renewed certificates first
+			client.UpdateCalls(func(_ context.Context, object runtime.Object, _ ...crc.UpdateOption) error {
+				if object.(*unstructured.Unstructured).GetName() != "eirinix" {
+					return nil
+				}
+				previousCA = oldCA.Certificate
+				persistCert(365)
+				eiriniManager.WebhookConfig.RenewBefore = 0
+				return apierrors.NewConflict(schema.GroupResource{}, "eirinix", nil)
+			})
+			eiriniManager.WebhookConfig.RenewBefore = 400 * 24 * time.Hour
+			Expect(eiriniManager.RotateCertificate()).To(Succeed())
+
+			Expect(eiriniManager.WebhookConfig.CaCertificate).To(Equal(caCert.Certificate))
+			Expect(client.UpdateCallCount()).To(Equal(2)) // Secret and mutating webhook configuration
+			_, object, _ := client.UpdateArgsForCall(1)
+			webhooks, _, _ := unstructured.NestedSlice(object.(*unstructured.Unstructured).Object, "webhooks")
+			caBundle, _, _ := unstructured.NestedString(webhooks[0].(map[string]interface{}), "clientConfig", "caBundle")
+			decoded, err := base64.StdEncoding.DecodeString(caBundle)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(decoded)).To(ContainSubstring(string(caCert.Certificate)))
+			Expect(string(decoded)).To(ContainSubstring(string(oldCA.Certificate)))
+			Expect(string(decoded)).ToNot(ContainSubstring("thecert"))
+		})
+
+		It("publishes the previous CA saved in the secret", func() {
+			previousCA = []byte("thepreviousca")
+			persistCert(365)
+			var caBundle []byte
+			client.CreateCalls(func(context context.Context, object runtime.Object, _ ...crc.CreateOption) error {
+				caBundle = object.(*admissionregistrationv1.MutatingWebhookConfiguration).Webhooks[0].ClientConfig.CABundle
+				return nil
+			})
+			Expect(eiriniManager.OperatorSetup()).To(Succeed())
+			eiriniManager.AddExtension(eirinixcatalog.SimpleExtension())
+			Expect(eiriniManager.LoadExtensions()).To(Succeed())
+
+			Expect(string(caBundle)).To(ContainSubstring(string(caCert.Certificate)))
+			Expect(string(caBundle)).To(ContainSubstring("thepreviousca"))
+			Expect(generator.GenerateCertificateCallCount()).To(Equal(0))
+		})
+
 		It("does not overwrite the existing secret", func() {
 			err := eiriniManager.OperatorSetup()
 			Expect(err).ToNot(HaveOccurred())
@@ -209,15 +439,15 @@ var _ = Describe("Extension Manager", func() {
 
 		It("generates the webhook configuration", func() {
 			client.CreateCalls(func(context context.Context, object runtime.Object, _ ...crc.CreateOption) error {
-				config := object.(*admissionregistrationv1beta1.MutatingWebhookConfiguration)
+				config := object.(*admissionregistrationv1.MutatingWebhookConfiguration)
 				Expect(config.Name).To(Equal("eirini-x-mutating-hook"))
 				Expect(len(config.Webhooks)).To(Equal(1))
 
 				wh := config.Webhooks[0]
 				Expect(wh.Name).To(Equal("0.eirini-x.org"))
 				Expect(*wh.ClientConfig.URL).To(Equal(fmt.Sprintf("https://%s:%d/0", eiriniManager.Options.Host, eiriniManager.Options.Port)))
-				Expect(wh.ClientConfig.CABundle).To(ContainSubstring("the-ca-cert"))
-				Expect(*wh.FailurePolicy).To(Equal(admissionregistrationv1beta1.Fail))
+				Expect(wh.ClientConfig.CABundle).To(Equal(caCert.Certificate))
+				Expect(*wh.FailurePolicy).To(Equal(admissionregistrationv1.Fail))
 				return nil
 			})
 			err := eiriniManager.OperatorSetup()
@@ -231,6 +461,687 @@ var _ = Describe("Extension Manager", func() {
 		})
 	})
 
+	Context("External certificates", func() {
+		var dir string
+
+		BeforeEach(func() {
+			var err error
+			dir, err = ioutil.TempDir("", "external-cert")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ioutil.WriteFile(filepath.Join(dir, "tls.crt"), []byte("external-cert"), 0644)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(dir, "tls.key"), []byte("external-key"), 0600)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(dir, "ca.crt"), []byte("external-ca"), 0644)).To(Succeed())
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(dir)
+		})
+
+		It("serves the certificates of a directory", func() {
+			eiriniManager.Options.ExternalCertificate = &ExternalCertificate{Dir: dir}
+			Expect(eiriniManager.OperatorSetup()).To(Succeed())
+			Expect(generator.GenerateCertificateCallCount()).To(Equal(0))
+			Expect(eiriniManager.WebhookServer.CertDir).To(Equal(dir))
+			Expect(eiriniManager.WebhookConfig.CaCertificate).To(Equal([]byte("external-ca")))
+			Expect(manager.AddCallCount()).To(Equal(1))
+
+			eiriniManager.AddExtension(eirinixcatalog.SimpleExtension())
+			Expect(eiriniManager.LoadExtensions()).To(Succeed())
+			_, object, _ := client.CreateArgsForCall(0)
+			config := object.(*admissionregistrationv1.MutatingWebhookConfiguration)
+			Expect(config.Webhooks[0].ClientConfig.CABundle).To(Equal([]byte("external-ca")))
+		})
+
+		It("publishes the CA bundle when it changes", func() {
+			eiriniManager.Options.ExternalCertificate = &ExternalCertificate{Dir: dir}
+			Expect(eiriniManager.OperatorSetup()).To(Succeed())
+
+			Expect(eiriniManager.ReloadExternalCertificate()).To(Succeed())
+			Expect(client.UpdateCallCount()).To(Equal(0))
+
+			client.GetReturns(nil) // The webhook configurations are registered
+
+			Expect(ioutil.WriteFile(filepath.Join(dir, "ca.crt"), []byte("renewed-ca"), 0644)).To(Succeed())
+			Expect(eiriniManager.ReloadExternalCertificate()).To(Succeed())
+			Expect(client.UpdateCallCount()).To(Equal(2)) // Mutating and validating webhook configurations
+			Expect(string(eiriniManager.WebhookConfig.CaCertificate)).To(Equal("renewed-ca"))
+		})
+
+		It("takes the CA bundle from the given file", func() {
+			Expect(ioutil.WriteFile(filepath.Join(dir, "bundle.pem"), []byte("bundle"), 0644)).To(Succeed())
+			eiriniManager.Options.ExternalCertificate = &ExternalCertificate{Dir: dir, CAFile: filepath.Join(dir, "bundle.pem")}
+			Expect(eiriniManager.OperatorSetup()).To(Succeed())
+			Expect(eiriniManager.WebhookConfig.CaCertificate).To(Equal([]byte("bundle")))
+		})
+
+		It("serves the certificates of a secret", func() {
+			client.GetCalls(func(_ context.Context, nn types.NamespacedName, object runtime.Object) error {
+				if u, ok := object.(*unstructured.Unstructured); ok && u.GetKind() == "Secret" {
+					Expect(nn).To(Equal(types.NamespacedName{Name: "webhook-tls", Namespace: "cert-manager"}))
+					u.Object["data"] = map[string]interface{}{
+						"tls.crt": base64.StdEncoding.EncodeToString([]byte("secret-cert")),
+						"tls.key": base64.StdEncoding.EncodeToString([]byte("secret-key")),
+						"ca":      base64.StdEncoding.EncodeToString([]byte("secret-ca")),
+					}
+				}
+				return nil
+			})
+			eiriniManager.Options.SetupCertificateName = "test-external-secret"
+			defer os.RemoveAll(filepath.Join(os.TempDir(), "test-external-secret"))
+			eiriniManager.Options.ExternalCertificate = &ExternalCertificate{SecretName: "webhook-tls", SecretNamespace: "cert-manager", CAKey: "ca"}
+
+			Expect(eiriniManager.OperatorSetup()).To(Succeed())
+			Expect(eiriniManager.WebhookConfig.CaCertificate).To(Equal([]byte("secret-ca")))
+			tlsCert, err := ioutil.ReadFile(filepath.Join(eiriniManager.WebhookServer.CertDir, "tls.crt"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(tlsCert)).To(Equal("secret-cert"))
+		})
+
+		It("needs a source", func() {
+			eiriniManager.Options.ExternalCertificate = &ExternalCertificate{}
+			Expect(eiriniManager.OperatorSetup()).To(MatchError(ContainSubstring("The external certificate needs a directory or a secret name")))
+		})
+	})
+
+	Context("Extensions with admission options", func() {
+		It("registers each webhook with the options of its Extension", func() {
+			ignore := admissionregistrationv1.Ignore
+			var config *admissionregistrationv1.MutatingWebhookConfiguration
+			client.CreateCalls(func(context context.Context, object runtime.Object, _ ...crc.CreateOption) error {
+				if c, ok := object.(*admissionregistrationv1.MutatingWebhookConfiguration); ok {
+					config = c
+				}
+				return nil
+			})
+			err := eiriniManager.OperatorSetup()
+			Expect(err).ToNot(HaveOccurred())
+
+			eiriniManager.AddExtension(eirinixcatalog.SimpleExtension())
+			eiriniManager.AddExtension(eirinixcatalog.SimpleExtensionWithOptions(AdmissionOptions{FailurePolicy: &ignore}))
+			err = eiriniManager.LoadExtensions()
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(config).ToNot(BeNil())
+			Expect(config.Webhooks).To(HaveLen(2))
+			Expect(*config.Webhooks[0].FailurePolicy).To(Equal(admissionregistrationv1.Fail))
+			Expect(*config.Webhooks[1].FailurePolicy).To(Equal(admissionregistrationv1.Ignore))
+		})
+	})
+
+	Context("Validators", func() {
+		It("registers the validators in a validating webhook configuration", func() {
+			var config *admissionregistrationv1.ValidatingWebhookConfiguration
+			client.CreateCalls(func(context context.Context, object runtime.Object, _ ...crc.CreateOption) error {
+				if c, ok := object.(*admissionregistrationv1.ValidatingWebhookConfiguration); ok {
+					config = c
+				}
+				return nil
+			})
+			Expect(eiriniManager.OperatorSetup()).To(Succeed())
+
+			Expect(eiriniManager.AddExtension(eirinixcatalog.SimpleValidator())).To(Succeed())
+			Expect(eiriniManager.ListValidators()).To(HaveLen(1))
+			Expect(eiriniManager.LoadExtensions()).To(Succeed())
+
+			Expect(config).ToNot(BeNil())
+			Expect(config.Name).To(Equal("eirini-x-validating-hook"))
+			Expect(config.Webhooks).To(HaveLen(1))
+			Expect(config.Webhooks[0].Name).To(Equal("validate-0.eirini-x.org"))
+			Expect(config.Webhooks[0].ClientConfig.CABundle).To(Equal(eiriniManager.WebhookConfig.CaCertificate))
+			Expect(client.CreateCallCount()).To(Equal(3)) // secret, mutating and validating configs
+		})
+
+		It("doesn't register a validating webhook configuration without validators", func() {
+			client.GetCalls(func(_ context.Context, nn types.NamespacedName, object runtime.Object) error {
+				if object.GetObjectKind().GroupVersionKind().Group == "admissionregistration.k8s.io" {
+					return apierrors.NewNotFound(schema.GroupResource{}, nn.Name)
+				}
+				return nil
+			})
+			Expect(eiriniManager.OperatorSetup()).To(Succeed())
+			Expect(eiriniManager.LoadExtensions()).To(Succeed())
+			Expect(client.CreateCallCount()).To(Equal(2)) // secret and mutating config
+			Expect(client.DeleteCallCount()).To(BeZero())
+		})
+
+		It("removes its validating webhooks once the validators are gone", func() {
+			existing := &unstructured.Unstructured{Object: map[string]interface{}{
+				"metadata": map[string]interface{}{"name": "eirini-x-validating-hook"},
+				"webhooks": []interface{}{
+					map[string]interface{}{"name": "validate-0.eirini-x.org"},
+					map[string]interface{}{"name": "other.example.org"},
+				},
+			}}
+			client.GetCalls(func(_ context.Context, nn types.NamespacedName, object runtime.Object) error {
+				switch object.GetObjectKind().GroupVersionKind().Kind {
+				case "ValidatingWebhookConfiguration":
+					existing.DeepCopyInto(object.(*unstructured.Unstructured))
+					return nil
+				case "MutatingWebhookConfiguration":
+					return apierrors.NewNotFound(schema.GroupResource{}, nn.Name)
+				}
+				return nil
+			})
+			Expect(eiriniManager.OperatorSetup()).To(Succeed())
+			Expect(eiriniManager.LoadExtensions()).To(Succeed())
+
+			Expect(client.UpdateCallCount()).To(Equal(1))
+			_, object, _ := client.UpdateArgsForCall(0)
+			config := object.(*unstructured.Unstructured)
+			Expect(config.GetName()).To(Equal("eirini-x-validating-hook"))
+			Expect(config.Object["webhooks"]).To(Equal([]interface{}{map[string]interface{}{"name": "other.example.org"}}))
+		})
+	})
+
+	Context("Registered webhook configurations", func() {
+		var existing *unstructured.Unstructured
+
+		BeforeEach(func() {
+			existing = &unstructured.Unstructured{Object: map[string]interface{}{
+				"metadata": map[string]interface{}{"name": "eirini-x-mutating-hook", "resourceVersion": "42"},
+				"webhooks": []interface{}{
+					map[string]interface{}{"name": "other.example.org"},
+					map[string]interface{}{"name": "stale.eirini-x.org"},
+					map[string]interface{}{"name": "0.eirini-x.org"},
+				},
+			}}
+			client.GetCalls(func(_ context.Context, nn types.NamespacedName, object runtime.Object) error {
+				switch object.GetObjectKind().GroupVersionKind().Kind {
+				case "MutatingWebhookConfiguration":
+					existing.DeepCopyInto(object.(*unstructured.Unstructured))
+					return nil
+				case "ValidatingWebhookConfiguration":
+					return apierrors.NewNotFound(schema.GroupResource{}, nn.Name)
+				}
+				return nil
+			})
+			Expect(eiriniManager.OperatorSetup()).To(Succeed())
+			Expect(eiriniManager.AddExtension(eirinixcatalog.SimpleExtension())).To(Succeed())
+		})
+
+		webhookNames := func(config *unstructured.Unstructured) []string {
+			webhooks, _, err := unstructured.NestedSlice(config.Object, "webhooks")
+			Expect(err).ToNot(HaveOccurred())
+			names := []string{}
+			for _, w := range webhooks {
+				names = append(names, w.(map[string]interface{})["name"].(string))
+			}
+			return names
+		}
+
+		It("updates the configuration in place, preserving the webhooks of other operators", func() {
+			Expect(eiriniManager.LoadExtensions()).To(Succeed())
+
+			Expect(client.DeleteCallCount()).To(Equal(0))
+			Expect(client.CreateCallCount()).To(Equal(1)) // secret
+			Expect(client.UpdateCallCount()).To(Equal(1))
+			_, object, _ := client.UpdateArgsForCall(0)
+			config := object.(*unstructured.Unstructured)
+			Expect(config.GetName()).To(Equal("eirini-x-mutating-hook"))
+			Expect(config.GetResourceVersion()).To(Equal("42"))
+			Expect(webhookNames(config)).To(Equal([]string{"0.eirini-x.org", "other.example.org"}))
+		})
+
+		It("retries the registration on conflicts", func() {
+			client.UpdateReturnsOnCall(0, apierrors.NewConflict(schema.GroupResource{}, "eirini-x-mutating-hook", nil))
+			Expect(eiriniManager.LoadExtensions()).To(Succeed())
+			Expect(client.UpdateCallCount()).To(Equal(2))
+		})
+
+		It("updates the configuration created concurrently by another replica", func() {
+			found := false
+			client.GetCalls(func(_ context.Context, nn types.NamespacedName, object runtime.Object) error {
+				if object.GetObjectKind().GroupVersionKind().Group != "admissionregistration.k8s.io" {
+					return nil
+				}
+				if !found || object.GetObjectKind().GroupVersionKind().Kind != "MutatingWebhookConfiguration" {
+					found = true
+					return apierrors.NewNotFound(schema.GroupResource{}, nn.Name)
+				}
+				existing.DeepCopyInto(object.(*unstructured.Unstructured))
+				return nil
+			})
+			client.CreateReturnsOnCall(1, apierrors.NewAlreadyExists(schema.GroupResource{}, "eirini-x-mutating-hook"))
+
+			Expect(eiriniManager.LoadExtensions()).To(Succeed())
+			Expect(client.CreateCallCount()).To(Equal(2)) // secret and mutating config
+			Expect(client.UpdateCallCount()).To(Equal(1))
+		})
+	})
+
+	Context("Unregistering the extensions", func() {
+		var existing map[string]*unstructured.Unstructured
+
+		BeforeEach(func() {
+			existing = map[string]*unstructured.Unstructured{
+				"MutatingWebhookConfiguration": {Object: map[string]interface{}{
+					"metadata": map[string]interface{}{"name": "eirini-x-mutating-hook"},
+					"webhooks": []interface{}{
+						map[string]interface{}{"name": "0.eirini-x.org"},
+						map[string]interface{}{"name": "other.example.org"},
+					},
+				}},
+				"ValidatingWebhookConfiguration": {Object: map[string]interface{}{
+					"metadata": map[string]interface{}{"name": "eirini-x-validating-hook"},
+					"webhooks": []interface{}{
+						map[string]interface{}{"name": "validate-0.eirini-x.org"},
+					},
+				}},
+			}
+			client.GetCalls(func(_ context.Context, nn types.NamespacedName, object runtime.Object) error {
+				if config, ok := existing[object.GetObjectKind().GroupVersionKind().Kind]; ok {
+					config.DeepCopyInto(object.(*unstructured.Unstructured))
+					return nil
+				}
+				if object.GetObjectKind().GroupVersionKind().Group == "admissionregistration.k8s.io" {
+					return apierrors.NewNotFound(schema.GroupResource{}, nn.Name)
+				}
+				return nil
+			})
+			eiriniManager.Options.WebhookNamespace = "cf"
+			Expect(eiriniManager.OperatorSetup()).To(Succeed())
+		})
+
+		It("removes the webhooks, the certificates and the namespace label of the operator", func() {
+			Expect(eiriniManager.UnregisterExtensions()).To(Succeed())
+
+			Expect(client.UpdateCallCount()).To(Equal(1))
+			_, object, _ := client.UpdateArgsForCall(0)
+			config := object.(*unstructured.Unstructured)
+			Expect(config.GetName()).To(Equal("eirini-x-mutating-hook"))
+			Expect(config.Object["webhooks"]).To(Equal([]interface{}{map[string]interface{}{"name": "other.example.org"}}))
+
+			Expect(client.DeleteCallCount()).To(Equal(2))
+			_, object, _ = client.DeleteArgsForCall(0)
+			Expect(object.(*unstructured.Unstructured).GetName()).To(Equal("eirini-x-validating-hook"))
+			_, object, _ = client.DeleteArgsForCall(1)
+			secret := object.(*unstructured.Unstructured)
+			Expect(secret.GetKind()).To(Equal("Secret"))
+			Expect(secret.GetName()).To(Equal("eirini-x-setupcertificate"))
+			Expect(secret.GetNamespace()).To(Equal("cf"))
+
+			Expect(client.PatchCallCount()).To(Equal(2)) // label set on setup, then removed
+			_, object, patch, _ := client.PatchArgsForCall(1)
+			Expect(object.(*unstructured.Unstructured).GetName()).To(Equal("default"))
+			data, err := patch.Data(object)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(data)).To(Equal(`{"metadata":{"labels":{"eirini-x-ns":null}}}`))
+		})
+
+		It("retries on conflicts with the changes of other operators", func() {
+			existing["ValidatingWebhookConfiguration"].SetResourceVersion("7")
+			conflict := apierrors.NewConflict(schema.GroupResource{}, "eirini-x-mutating-hook", errors.New("modified"))
+			client.UpdateReturnsOnCall(0, conflict)
+			client.DeleteReturnsOnCall(0, conflict)
+
+			Expect(eiriniManager.UnregisterExtensions()).To(Succeed())
+			Expect(client.UpdateCallCount()).To(Equal(2))
+			_, object, _ := client.UpdateArgsForCall(1)
+			Expect(object.(*unstructured.Unstructured).Object["webhooks"]).To(Equal([]interface{}{map[string]interface{}{"name": "other.example.org"}}))
+
+			Expect(client.DeleteCallCount()).To(Equal(3))
+			for i := 0; i < 2; i++ {
+				_, object, options := client.DeleteArgsForCall(i)
+				Expect(object.(*unstructured.Unstructured).GetName()).To(Equal("eirini-x-validating-hook"))
+				deleteOptions := &crc.DeleteOptions{}
+				deleteOptions.ApplyOptions(options)
+				Expect(*deleteOptions.Preconditions.ResourceVersion).To(Equal("7"))
+			}
+		})
+
+		It("skips what doesn't exist", func() {
+			existing = map[string]*unstructured.Unstructured{}
+			client.DeleteReturns(apierrors.NewNotFound(schema.GroupResource{}, "eirini-x-setupcertificate"))
+			client.PatchReturns(apierrors.NewNotFound(schema.GroupResource{}, "default"))
+
+			Expect(eiriniManager.UnregisterExtensions()).To(Succeed())
+			Expect(client.UpdateCallCount()).To(Equal(0))
+			Expect(client.DeleteCallCount()).To(Equal(1))
+		})
+
+		It("leaves the external certificates untouched", func() {
+			existing = map[string]*unstructured.Unstructured{}
+			eiriniManager.Options.ExternalCertificate = &ExternalCertificate{SecretName: "external"}
+
+			Expect(eiriniManager.UnregisterExtensions()).To(Succeed())
+			Expect(client.DeleteCallCount()).To(Equal(0))
+		})
+	})
+
+	Context("Rendering the manifests", func() {
+		BeforeEach(func() {
+			eiriniManager.KubeManager = nil
+			eiriniManager.Options.ServiceName = "extensions"
+			eiriniManager.Options.WebhookNamespace = "cf"
+			Expect(eiriniManager.AddExtension(eirinixcatalog.SimpleExtension())).To(Succeed())
+		})
+
+		kinds := func(objects []runtime.Object) []string {
+			kinds := []string{}
+			for _, o := range objects {
+				kinds = append(kinds, o.GetObjectKind().GroupVersionKind().Kind)
+			}
+			return kinds
+		}
+
+		It("returns the objects created by the registration and the roles of the manager", func() {
+			objects, err := eiriniManager.Manifests()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(kinds(objects)).To(Equal([]string{"Secret", "Namespace", "MutatingWebhookConfiguration", "ClusterRole", "Role", "Role", "ServiceAccount", "ClusterRoleBinding", "RoleBinding", "RoleBinding"}))
+
+			secret := objects[0].(*corev1.Secret)
+			Expect(secret.Name).To(Equal("eirini-x-setupcertificate"))
+			Expect(secret.Namespace).To(Equal("cf"))
+			Expect(secret.Data["ca_certificate"]).To(Equal([]byte("thecert")))
+
+			namespace := objects[1].(*corev1.Namespace)
+			Expect(namespace.Name).To(Equal("default"))
+			Expect(namespace.Labels).To(Equal(map[string]string{"eirini-x-ns": "default"}))
+
+			config := objects[2].(*admissionregistrationv1.MutatingWebhookConfiguration)
+			Expect(config.Name).To(Equal("eirini-x-mutating-hook"))
+			Expect(config.Webhooks).To(HaveLen(1))
+			Expect(config.Webhooks[0].Name).To(Equal("0.eirini-x.org"))
+			Expect(config.Webhooks[0].ClientConfig.CABundle).To(Equal([]byte("thecert")))
+			Expect(config.Webhooks[0].ClientConfig.Service.Name).To(Equal("extensions"))
+
+			Expect(objects[3].(*rbacv1.ClusterRole).Rules).To(HaveLen(2))
+			Expect(objects[4].(*rbacv1.Role).Namespace).To(Equal("default"))
+			Expect(objects[4].(*rbacv1.Role).Rules[0].Resources).To(Equal([]string{"pods"}))
+			Expect(objects[5].(*rbacv1.Role).Namespace).To(Equal("cf"))
+			Expect(objects[5].(*rbacv1.Role).Rules[0].Resources).To(Equal([]string{"secrets"}))
+
+			serviceAccount := objects[6].(*corev1.ServiceAccount)
+			Expect(serviceAccount.Name).To(Equal("eirini-x"))
+			Expect(serviceAccount.Namespace).To(Equal("cf"))
+			subjects := []rbacv1.Subject{{Kind: "ServiceAccount", Name: "eirini-x", Namespace: "cf"}}
+			clusterRoleBinding := objects[7].(*rbacv1.ClusterRoleBinding)
+			Expect(clusterRoleBinding.RoleRef).To(Equal(rbacv1.RoleRef{APIGroup: "rbac.authorization.k8s.io", Kind: "ClusterRole", Name: "eirini-x"}))
+			Expect(clusterRoleBinding.Subjects).To(Equal(subjects))
+			for i, namespace := range []string{"default", "cf"} {
+				roleBinding := objects[8+i].(*rbacv1.RoleBinding)
+				Expect(roleBinding.Namespace).To(Equal(namespace))
+				Expect(roleBinding.RoleRef).To(Equal(rbacv1.RoleRef{APIGroup: "rbac.authorization.k8s.io", Kind: "Role", Name: "eirini-x"}))
+				Expect(roleBinding.Subjects).To(Equal(subjects))
+			}
+		})
+
+		It("binds the roles to the configured service account", func() {
+			eiriniManager.Options.ServiceAccountName = "extensions"
+			objects, err := eiriniManager.Manifests()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(objects[6].(*corev1.ServiceAccount).Name).To(Equal("extensions"))
+			Expect(objects[7].(*rbacv1.ClusterRoleBinding).Subjects).To(Equal([]rbacv1.Subject{{Kind: "ServiceAccount", Name: "extensions", Namespace: "cf"}}))
+		})
+
+		It("includes the validating webhook configuration", func() {
+			Expect(eiriniManager.AddExtension(eirinixcatalog.SimpleValidator())).To(Succeed())
+			objects, err := eiriniManager.Manifests()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(kinds(objects)).To(ContainElement("ValidatingWebhookConfiguration"))
+		})
+
+		It("grants access to the pods of all the namespaces", func() {
+			eiriniManager.Options.Namespace = ""
+			objects, err := eiriniManager.Manifests()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(kinds(objects)).To(Equal([]string{"Secret", "MutatingWebhookConfiguration", "ClusterRole", "Role", "ServiceAccount", "ClusterRoleBinding", "RoleBinding"}))
+			Expect(objects[2].(*rbacv1.ClusterRole).Rules[1].Resources).To(Equal([]string{"pods"}))
+		})
+
+		It("only reads the external certificates", func() {
+			eiriniManager.Options.ExternalCertificate = &ExternalCertificate{SecretName: "external"}
+			objects, err := eiriniManager.Manifests()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(kinds(objects)).To(Equal([]string{"Namespace", "MutatingWebhookConfiguration", "ClusterRole", "Role", "Role", "ServiceAccount", "ClusterRoleBinding", "RoleBinding", "RoleBinding"}))
+			Expect(objects[1].(*admissionregistrationv1.MutatingWebhookConfiguration).Webhooks[0].ClientConfig.CABundle).To(BeEmpty())
+			Expect(objects[4].(*rbacv1.Role).Rules).To(Equal([]rbacv1.PolicyRule{{
+				APIGroups:     []string{""},
+				Resources:     []string{"secrets"},
+				ResourceNames: []string{"external"},
+				Verbs:         []string{"get"},
+			}}))
+		})
+
+		It("grants access to the leader election lock", func() {
+			eiriniManager.Options.LeaderElection = true
+			eiriniManager.Options.LeaderElectionNamespace = "kube-system"
+			eiriniManager.Options.LeaderElectionID = "eirini-x-leader"
+			objects, err := eiriniManager.Manifests()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(kinds(objects)).To(Equal([]string{"Secret", "Namespace", "MutatingWebhookConfiguration", "ClusterRole", "Role", "Role", "Role", "ServiceAccount", "ClusterRoleBinding", "RoleBinding", "RoleBinding", "RoleBinding"}))
+
+			role := objects[6].(*rbacv1.Role)
+			Expect(role.Namespace).To(Equal("kube-system"))
+			Expect(role.Rules).To(Equal([]rbacv1.PolicyRule{
+				{APIGroups: []string{""}, Resources: []string{"configmaps"}, ResourceNames: []string{"eirini-x-leader"}, Verbs: []string{"get", "update"}},
+				{APIGroups: []string{""}, Resources: []string{"configmaps"}, Verbs: []string{"create"}},
+				{APIGroups: []string{""}, Resources: []string{"events"}, Verbs: []string{"create", "patch"}},
+			}))
+		})
+
+		It("puts the leader election lock in the webhook namespace by default", func() {
+			eiriniManager.Options.LeaderElection = true
+			objects, err := eiriniManager.Manifests()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(kinds(objects)).To(Equal([]string{"Secret", "Namespace", "MutatingWebhookConfiguration", "ClusterRole", "Role", "Role", "ServiceAccount", "ClusterRoleBinding", "RoleBinding", "RoleBinding"}))
+			role := objects[5].(*rbacv1.Role)
+			Expect(role.Namespace).To(Equal("cf"))
+			Expect(role.Rules).To(HaveLen(5)) // certificates secret and leader election lock
+			Expect(role.Rules[2].ResourceNames).To(Equal([]string{eiriniManager.Options.LeaderElectionID}))
+		})
+
+		It("renders the manifests as YAML without connecting to the cluster", func() {
+			var out strings.Builder
+			Expect(eiriniManager.RenderManifests(&out)).To(Succeed())
+			Expect(strings.Count(out.String(), "---\n")).To(Equal(10))
+			Expect(out.String()).To(ContainSubstring("kind: MutatingWebhookConfiguration"))
+			Expect(out.String()).To(ContainSubstring("name: eirini-x-mutating-hook"))
+			Expect(client.GetCallCount()).To(Equal(0))
+			Expect(client.CreateCallCount()).To(Equal(0))
+		})
+	})
+
+	Context("Health probes", func() {
+		var (
+			readiness, liveness map[string]healthz.Checker
+			synced              bool
+		)
+
+		BeforeEach(func() {
+			readiness = map[string]healthz.Checker{}
+			liveness = map[string]healthz.Checker{}
+			manager.AddReadyzCheckCalls(func(name string, check healthz.Checker) error {
+				readiness[name] = check
+				return nil
+			})
+			manager.AddHealthzCheckCalls(func(name string, check healthz.Checker) error {
+				liveness[name] = check
+				return nil
+			})
+			synced = false
+			manager.GetCacheReturns(syncedCache{synced: &synced})
+			eiriniManager.Options.HealthProbeBindAddress = ":8081"
+		})
+
+		check := func(checks map[string]healthz.Checker, name string) error {
+			Expect(checks).To(HaveKey(name))
+			return checks[name](httptest.NewRequest("GET", "/readyz", nil))
+		}
+
+		It("is ready once the certificates are written, the webhooks registered and the cache synced", func() {
+			Expect(eiriniManager.OperatorSetup()).To(Succeed())
+			Expect(readiness).To(HaveLen(3))
+			Expect(check(readiness, "certificates")).To(Succeed())
+			Expect(check(readiness, "webhooks")).To(MatchError("The extensions aren't registered yet"))
+			Expect(check(readiness, "cache")).To(MatchError("The kube cache isn't synced yet"))
+
+			Expect(eiriniManager.LoadExtensions()).To(Succeed())
+			synced = true
+			Expect(check(readiness, "webhooks")).To(Succeed())
+			Expect(check(readiness, "cache")).To(Succeed())
+		})
+
+		It("is alive while the webhook server listens", func() {
+			port, err := freeport.GetFreePort()
+			Expect(err).ToNot(HaveOccurred())
+			eiriniManager.Options.Port = int32(port)
+			Expect(eiriniManager.OperatorSetup()).To(Succeed())
+			Expect(liveness).To(HaveLen(2))
+			Expect(check(liveness, "watcher")).To(Succeed())
+			Expect(check(liveness, "webhook-server")).ToNot(Succeed())
+
+			listener, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+			Expect(err).ToNot(HaveOccurred())
+			defer listener.Close()
+			Expect(check(liveness, "webhook-server")).To(Succeed())
+		})
+
+		It("checks the default port of the webhook server when the port isn't set", func() {
+			eiriniManager.Options.Port = 0
+			Expect(eiriniManager.OperatorSetup()).To(Succeed())
+			Expect(eiriniManager.WebhookServer.Port).To(BeZero())
+			err := check(liveness, "webhook-server")
+			if err != nil {
+				Expect(err.Error()).To(ContainSubstring(":443"))
+			}
+
+			port, err := freeport.GetFreePort()
+			Expect(err).ToNot(HaveOccurred())
+			eiriniManager.WebhookServer.Port = port
+			Expect(check(liveness, "webhook-server")).ToNot(Succeed())
+			listener, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+			Expect(err).ToNot(HaveOccurred())
+			defer listener.Close()
+			Expect(check(liveness, "webhook-server")).To(Succeed())
+		})
+
+		It("runs the checks added to the manager", func() {
+			eiriniManager.AddReadinessCheck("extension", func(_ *http.Request) error { return errors.New("not ready") })
+			eiriniManager.AddLivenessCheck("extension", healthz.Ping)
+			Expect(eiriniManager.OperatorSetup()).To(Succeed())
+			Expect(check(readiness, "extension")).To(MatchError("not ready"))
+			Expect(check(liveness, "extension")).To(Succeed())
+		})
+
+		It("is disabled without a bind address", func() {
+			eiriniManager.Options.HealthProbeBindAddress = ""
+			Expect(eiriniManager.OperatorSetup()).To(Succeed())
+			Expect(readiness).To(BeEmpty())
+			Expect(liveness).To(BeEmpty())
+		})
+	})
+
+	Context("Named extensions", func() {
+		var config *admissionregistrationv1.MutatingWebhookConfiguration
+
+		BeforeEach(func() {
+			config = nil
+			client.CreateCalls(func(context context.Context, object runtime.Object, _ ...crc.CreateOption) error {
+				if c, ok := object.(*admissionregistrationv1.MutatingWebhookConfiguration); ok {
+					config = c
+				}
+				return nil
+			})
+			Expect(eiriniManager.OperatorSetup()).To(Succeed())
+		})
+
+		It("generates paths and names from the extension name", func() {
+			eiriniManager.AddExtension(eirinixcatalog.SimpleExtension())
+			eiriniManager.AddExtension(eirinixcatalog.NamedExtension("volume"))
+			Expect(eiriniManager.LoadExtensions()).To(Succeed())
+
+			Expect(config).ToNot(BeNil())
+			Expect(config.Webhooks).To(HaveLen(2))
+			Expect(config.Webhooks[0].Name).To(Equal("0.eirini-x.org"))
+			Expect(config.Webhooks[1].Name).To(Equal("volume.eirini-x.org"))
+			Expect(*config.Webhooks[1].ClientConfig.URL).To(Equal(fmt.Sprintf("https://%s:%d/volume", eiriniManager.Options.Host, eiriniManager.Options.Port)))
+		})
+
+		It("generates paths for the resource extensions from their kind", func() {
+			eiriniManager.AddExtension(eirinixcatalog.SimpleExtension())
+			eiriniManager.AddExtension(&catalog.AnnotateStatefulSetExtension{})
+			Expect(eiriniManager.LoadExtensions()).To(Succeed())
+
+			Expect(config).ToNot(BeNil())
+			Expect(config.Webhooks).To(HaveLen(2))
+			Expect(config.Webhooks[1].Name).To(Equal("statefulset-0.eirini-x.org"))
+			Expect(config.Webhooks[1].Rules[0].Resources).To(Equal([]string{"statefulsets"}))
+		})
+
+		It("fails on duplicated names", func() {
+			eiriniManager.AddExtension(eirinixcatalog.NamedExtension("volume"))
+			eiriniManager.AddExtension(eirinixcatalog.NamedExtension("volume"))
+			err := eiriniManager.LoadExtensions()
+			Expect(err).To(MatchError("Duplicate extension name volume"))
+		})
+
+		It("fails on invalid names", func() {
+			eiriniManager.AddExtension(eirinixcatalog.NamedExtension("Not/Valid"))
+			err := eiriniManager.LoadExtensions()
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("Invalid extension name"))
+		})
+	})
+
+	Context("Admission registration version", func() {
+		var fakeDiscovery *fakediscovery.FakeDiscovery
+
+		BeforeEach(func() {
+			fakeDiscovery = &fakediscovery.FakeDiscovery{Fake: &clienttesting.Fake{}}
+			eiriniManager.Discovery = fakeDiscovery
+		})
+
+		It("defaults to v1 without a discovery client", func() {
+			eiriniManager.Discovery = nil
+			Expect(eiriniManager.AdmissionRegistrationVersion()).To(Equal("v1"))
+		})
+
+		It("prefers v1 when the cluster serves it", func() {
+			fakeDiscovery.Resources = []*metav1.APIResourceList{
+				{GroupVersion: "admissionregistration.k8s.io/v1beta1"},
+				{GroupVersion: "admissionregistration.k8s.io/v1"},
+			}
+			Expect(eiriniManager.AdmissionRegistrationVersion()).To(Equal("v1"))
+		})
+
+		It("falls back to v1beta1 on old clusters", func() {
+			fakeDiscovery.Resources = []*metav1.APIResourceList{
+				{GroupVersion: "admissionregistration.k8s.io/v1beta1"},
+			}
+			Expect(eiriniManager.AdmissionRegistrationVersion()).To(Equal("v1beta1"))
+		})
+
+		It("fails if the cluster doesn't serve admission registration", func() {
+			fakeDiscovery.Resources = []*metav1.APIResourceList{{GroupVersion: "v1"}}
+			_, err := eiriniManager.AdmissionRegistrationVersion()
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("registers a v1beta1 configuration on old clusters", func() {
+			fakeDiscovery.Resources = []*metav1.APIResourceList{
+				{GroupVersion: "admissionregistration.k8s.io/v1beta1"},
+			}
+			var config *admissionregistrationv1beta1.MutatingWebhookConfiguration
+			client.CreateCalls(func(context context.Context, object runtime.Object, _ ...crc.CreateOption) error {
+				if c, ok := object.(*admissionregistrationv1beta1.MutatingWebhookConfiguration); ok {
+					config = c
+				}
+				return nil
+			})
+			err := eiriniManager.OperatorSetup()
+			Expect(err).ToNot(HaveOccurred())
+
+			eiriniManager.AddExtension(eirinixcatalog.SimpleExtension())
+			err = eiriniManager.LoadExtensions()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(eiriniManager.WebhookConfig.AdmissionRegistrationVersion).To(Equal("v1beta1"))
+			Expect(config).ToNot(BeNil())
+			Expect(config.Name).To(Equal("eirini-x-mutating-hook"))
+			Expect(config.Webhooks).To(HaveLen(1))
+		})
+	})
+
 	Context("Watchers", func() {
 		w := eirinixcatalog.SimpleWatcher()
 		BeforeEach(func() {
@@ -259,6 +1170,44 @@ var _ = Describe("Extension Manager", func() {
 			Expect(string(sw.Handled[1].Type)).To(Equal("1"))
 		})
 
+		It("returns the errors setting up the watch", func() {
+			eiriniManager.AddWatcher(w)
+			eiriniManager.Options.KubeConfig = "/does/not/exist"
+			stop := make(chan struct{})
+			defer close(stop)
+			Expect(eiriniManager.RunWatchers(stop)).To(MatchError(ContainSubstring("watching the pods")))
+		})
+
+		It("restarts the watch when its channel closes, until stopped", func() {
+			fakeCorev1 := &cfakes.FakeCoreV1Interface{}
+			fakePod := &cfakes.FakePodInterface{}
+			fakePod.WatchCalls(func(context.Context, metav1.ListOptions) (watch.Interface, error) {
+				// The watch expired, which closes the channel of the retry watcher
+				events := make(chan watch.Event, 1)
+				events <- watch.Event{Type: watch.Error, Object: &metav1.Status{
+					Status: metav1.StatusFailure,
+					Code:   http.StatusGone,
+					Reason: metav1.StatusReasonExpired,
+				}}
+				fakeWatch := &cfakes.FakeInterface{}
+				fakeWatch.ResultChanReturns(events)
+				return fakeWatch, nil
+			})
+			fakeCorev1.PodsReturns(fakePod)
+			eiriniManager.SetKubeClient(fakeCorev1)
+			eiriniManager.AddWatcher(w)
+
+			stop := make(chan struct{})
+			done := make(chan error)
+			go func() {
+				done <- eiriniManager.RunWatchers(stop)
+			}()
+
+			Eventually(fakePod.WatchCallCount, 5*time.Second).Should(BeNumerically(">=", 3))
+			close(stop)
+			Eventually(done, 5*time.Second).Should(Receive(BeNil()))
+		})
+
 		It("Generates the watcher correctly if filtering eirini apps", func() {
 			Expect(*eiriniManager.Options.FilterEiriniApps).To(Equal(true))
 			fakeCorev1 := &cfakes.FakeCoreV1Interface{}
@@ -387,3 +1336,13 @@ var _ = Describe("Extension Manager", func() {
 		})
 	})
 })
+
+// syncedCache is a cache reporting the given sync status
+type syncedCache struct {
+	cache.Cache
+	synced *bool
+}
+
+func (c syncedCache) WaitForCacheSync(_ <-chan struct{}) bool {
+	return *c.synced
+}
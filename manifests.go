@@ -0,0 +1,273 @@
+package extension
+
+import (
+	"fmt"
+	"io"
+
+	inmemorycredgen "code.cloudfoundry.org/quarks-utils/pkg/credsgen/in_memory_generator"
+	"github.com/pkg/errors"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/yaml"
+)
+
+// Manifests returns the objects the Manager creates in the cluster when registering the Extensions:
+// the webhook configurations, the certificates secret and the labelled namespace, along with the
+// ClusterRole and the Roles granting the Manager the permissions it needs at runtime, and the
+// ServiceAccountName with the bindings to those roles.
+//
+// It doesn't connect to the cluster: the certificates are generated, and the webhook configurations use
+// the admissionregistration.k8s.io/v1 API. With an ExternalCertificate the caBundle of the webhooks is left empty.
+func (m *DefaultExtensionManager) Manifests() ([]runtime.Object, error) {
+	if m.Credsgen == nil {
+		m.Credsgen = inmemorycredgen.NewInMemoryGenerator(m.Logger)
+	}
+	config := m.newWebhookConfig(nil)
+
+	webhooks, validatingWebhooks, err := m.generateWebhooks(&webhook.Server{})
+	if err != nil {
+		return nil, err
+	}
+
+	var objects []runtime.Object
+	if m.Options.ExternalCertificate == nil && (m.Options.SetupCertificate == nil || *m.Options.SetupCertificate) {
+		certificates, err := config.generateCertificate()
+		if err != nil {
+			return nil, errors.Wrap(err, "generating the webhook server certificate")
+		}
+		config.setCertificates(certificates)
+		objects = append(objects, &corev1.Secret{
+			TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "Secret"},
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      m.Options.SetupCertificateName,
+				Namespace: m.Options.WebhookNamespace,
+			},
+			Data: certificates.secretData(),
+		})
+	}
+
+	if m.Options.Namespace != "" {
+		objects = append(objects, &corev1.Namespace{
+			TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "Namespace"},
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   m.Options.Namespace,
+				Labels: map[string]string{m.Options.getDefaultNamespaceLabel(): m.Options.Namespace},
+			},
+		})
+	}
+
+	if m.Options.RegisterWebHook == nil || *m.Options.RegisterWebHook {
+		objects = append(objects, &admissionregistrationv1.MutatingWebhookConfiguration{
+			TypeMeta:   metav1.TypeMeta{APIVersion: admissionregistrationv1.SchemeGroupVersion.String(), Kind: "MutatingWebhookConfiguration"},
+			ObjectMeta: metav1.ObjectMeta{Name: config.ConfigName},
+			Webhooks:   config.GenerateAdmissionWebhook(webhooks),
+		})
+		if len(validatingWebhooks) > 0 {
+			objects = append(objects, &admissionregistrationv1.ValidatingWebhookConfiguration{
+				TypeMeta:   metav1.TypeMeta{APIVersion: admissionregistrationv1.SchemeGroupVersion.String(), Kind: "ValidatingWebhookConfiguration"},
+				ObjectMeta: metav1.ObjectMeta{Name: config.ValidatingConfigName},
+				Webhooks:   config.GenerateValidatingAdmissionWebhook(validatingWebhooks),
+			})
+		}
+	}
+
+	watchRules, err := m.watchPolicyRules()
+	if err != nil {
+		return nil, err
+	}
+	clusterRole := m.clusterRole(watchRules)
+	roles := m.roles(watchRules)
+	objects = append(objects, clusterRole)
+	for _, role := range roles {
+		objects = append(objects, role)
+	}
+
+	serviceAccount := &corev1.ServiceAccount{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "ServiceAccount"},
+		ObjectMeta: metav1.ObjectMeta{Name: m.Options.ServiceAccountName, Namespace: m.Options.WebhookNamespace},
+	}
+	subjects := []rbacv1.Subject{{Kind: rbacv1.ServiceAccountKind, Name: serviceAccount.Name, Namespace: serviceAccount.Namespace}}
+	objects = append(objects, serviceAccount, &rbacv1.ClusterRoleBinding{
+		TypeMeta:   metav1.TypeMeta{APIVersion: rbacv1.SchemeGroupVersion.String(), Kind: "ClusterRoleBinding"},
+		ObjectMeta: metav1.ObjectMeta{Name: clusterRole.Name},
+		RoleRef:    rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "ClusterRole", Name: clusterRole.Name},
+		Subjects:   subjects,
+	})
+	for _, role := range roles {
+		objects = append(objects, &rbacv1.RoleBinding{
+			TypeMeta:   metav1.TypeMeta{APIVersion: rbacv1.SchemeGroupVersion.String(), Kind: "RoleBinding"},
+			ObjectMeta: metav1.ObjectMeta{Name: role.Name, Namespace: role.Namespace},
+			RoleRef:    rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "Role", Name: role.Name},
+			Subjects:   subjects,
+		})
+	}
+	return objects, nil
+}
+
+// RenderManifests writes the Manifests as a multi-document YAML stream
+func (m *DefaultExtensionManager) RenderManifests(w io.Writer) error {
+	objects, err := m.Manifests()
+	if err != nil {
+		return err
+	}
+	for _, o := range objects {
+		data, err := yaml.Marshal(o)
+		if err != nil {
+			return errors.Wrapf(err, "rendering the %s", o.GetObjectKind().GroupVersionKind().Kind)
+		}
+		if _, err := fmt.Fprintf(w, "---\n%s", data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// clusterRole returns the permissions of the Manager on the cluster scoped resources, and on the resources
+// watched in all the namespaces if the Manager isn't restricted to one
+func (m *DefaultExtensionManager) clusterRole(watchRules []rbacv1.PolicyRule) *rbacv1.ClusterRole {
+	var rules []rbacv1.PolicyRule
+	if m.Options.RegisterWebHook == nil || *m.Options.RegisterWebHook {
+		rules = append(rules, rbacv1.PolicyRule{
+			APIGroups: []string{admissionregistrationv1.GroupName},
+			Resources: []string{"mutatingwebhookconfigurations", "validatingwebhookconfigurations"},
+			Verbs:     []string{"get", "create", "update", "delete"},
+		})
+	}
+	if m.Options.Namespace != "" {
+		rules = append(rules, rbacv1.PolicyRule{
+			APIGroups:     []string{""},
+			Resources:     []string{"namespaces"},
+			ResourceNames: []string{m.Options.Namespace},
+			Verbs:         []string{"get", "patch"},
+		})
+	} else {
+		rules = append(rules, watchRules...)
+	}
+
+	return &rbacv1.ClusterRole{
+		TypeMeta:   metav1.TypeMeta{APIVersion: rbacv1.SchemeGroupVersion.String(), Kind: "ClusterRole"},
+		ObjectMeta: metav1.ObjectMeta{Name: m.Options.OperatorFingerprint},
+		Rules:      rules,
+	}
+}
+
+// roles returns the permissions of the Manager on the resources watched in its namespace, on the
+// certificates secret, on the leader election lock and on the checkpoints config map, in one Role per namespace
+func (m *DefaultExtensionManager) roles(watchRules []rbacv1.PolicyRule) []*rbacv1.Role {
+	var namespaces []string
+	rules := map[string][]rbacv1.PolicyRule{}
+	addRule := func(namespace string, rule rbacv1.PolicyRule) {
+		if _, ok := rules[namespace]; !ok {
+			namespaces = append(namespaces, namespace)
+		}
+		rules[namespace] = append(rules[namespace], rule)
+	}
+
+	if m.Options.Namespace != "" {
+		for _, rule := range watchRules {
+			addRule(m.Options.Namespace, rule)
+		}
+	}
+
+	external := m.Options.ExternalCertificate
+	switch {
+	case external != nil && external.SecretName != "":
+		namespace := external.SecretNamespace
+		if namespace == "" {
+			namespace = m.Options.WebhookNamespace
+		}
+		addRule(namespace, rbacv1.PolicyRule{
+			APIGroups:     []string{""},
+			Resources:     []string{"secrets"},
+			ResourceNames: []string{external.SecretName},
+			Verbs:         []string{"get"},
+		})
+	case external == nil && (m.Options.SetupCertificate == nil || *m.Options.SetupCertificate):
+		addRule(m.Options.WebhookNamespace, rbacv1.PolicyRule{
+			APIGroups:     []string{""},
+			Resources:     []string{"secrets"},
+			ResourceNames: []string{m.Options.SetupCertificateName},
+			Verbs:         []string{"get", "update", "delete"},
+		})
+		addRule(m.Options.WebhookNamespace, rbacv1.PolicyRule{
+			APIGroups: []string{""},
+			Resources: []string{"secrets"},
+			Verbs:     []string{"create"},
+		})
+	}
+
+	if m.Options.LeaderElection {
+		for _, rule := range m.leaderElectionPolicyRules() {
+			addRule(m.leaderElectionNamespace(), rule)
+		}
+	}
+
+	if store, ok := m.Options.CheckpointStore.(*ConfigMapCheckpointStore); ok {
+		addRule(store.Namespace, rbacv1.PolicyRule{
+			APIGroups:     []string{""},
+			Resources:     []string{"configmaps"},
+			ResourceNames: []string{store.Name},
+			Verbs:         []string{"get", "update"},
+		})
+		addRule(store.Namespace, rbacv1.PolicyRule{
+			APIGroups: []string{""},
+			Resources: []string{"configmaps"},
+			Verbs:     []string{"create"},
+		})
+	}
+
+	roles := make([]*rbacv1.Role, 0, len(namespaces))
+	for _, namespace := range namespaces {
+		roles = append(roles, &rbacv1.Role{
+			TypeMeta:   metav1.TypeMeta{APIVersion: rbacv1.SchemeGroupVersion.String(), Kind: "Role"},
+			ObjectMeta: metav1.ObjectMeta{Name: m.Options.OperatorFingerprint, Namespace: namespace},
+			Rules:      rules[namespace],
+		})
+	}
+	return roles
+}
+
+// leaderElectionNamespace returns the namespace of the leader election lock. Without LeaderElectionNamespace,
+// the lock is in the namespace the extensions run in, which is assumed to be the WebhookNamespace
+func (m *DefaultExtensionManager) leaderElectionNamespace() string {
+	if m.Options.LeaderElectionNamespace != "" {
+		return m.Options.LeaderElectionNamespace
+	}
+	return m.Options.WebhookNamespace
+}
+
+// leaderElectionPolicyRules returns the permissions on the leader election lock, a config map, and on the
+// events recorded when the leadership changes
+func (m *DefaultExtensionManager) leaderElectionPolicyRules() []rbacv1.PolicyRule {
+	return []rbacv1.PolicyRule{
+		{
+			APIGroups:     []string{""},
+			Resources:     []string{"configmaps"},
+			ResourceNames: []string{m.Options.LeaderElectionID},
+			Verbs:         []string{"get", "update"},
+		},
+		{
+			APIGroups: []string{""},
+			Resources: []string{"configmaps"},
+			Verbs:     []string{"create"},
+		},
+		{
+			APIGroups: []string{""},
+			Resources: []string{"events"},
+			Verbs:     []string{"create", "patch"},
+		},
+	}
+}
+
+// podsPolicyRule returns the permissions of the watchers
+func podsPolicyRule() rbacv1.PolicyRule {
+	return rbacv1.PolicyRule{
+		APIGroups: []string{""},
+		Resources: []string{"pods"},
+		Verbs:     []string{"get", "list", "watch"},
+	}
+}
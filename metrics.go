@@ -0,0 +1,146 @@
+package extension
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/watch"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// DefaultMetricsBindAddress is the address serving the metrics if no MetricsBindAddress is given
+const DefaultMetricsBindAddress = ":8080"
+
+const metricsNamespace = "eirinix"
+
+var (
+	admissionRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "admission_requests_total",
+		Help:      "Number of admission requests handled per webhook, operation and result (allowed, denied or errored)",
+	}, []string{"webhook", "operation", "result"})
+
+	admissionDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "admission_duration_seconds",
+		Help:      "Time the extensions took to handle the admission requests, per webhook and operation",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"webhook", "operation"})
+
+	admissionPatchSize = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "admission_patch_bytes",
+		Help:      "Size of the JSON patches returned by the mutating webhooks",
+		Buckets:   prometheus.ExponentialBuckets(64, 4, 8),
+	}, []string{"webhook"})
+
+	watcherEvents = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "watcher_events_total",
+		Help:      "Number of events received by each watcher, per event type",
+	}, []string{"watcher", "type"})
+
+	chainExtensionRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "chain_extension_requests_total",
+		Help:      "Number of admission requests handled per extension of each ExtensionChain, operation and result",
+	}, []string{"chain", "extension", "operation", "result"})
+
+	chainExtensionDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "chain_extension_duration_seconds",
+		Help:      "Time each extension of the ExtensionChains took to handle the admission requests, per operation",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"chain", "extension", "operation"})
+
+	watcherRestarts = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "watcher_restarts_total",
+		Help:      "Number of times a watch was started again after it closed",
+	})
+
+	watcherQueueDepth = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "watcher_queue_depth",
+		Help:      "Number of events waiting in the queue of each watcher, see WatcherQueue",
+	}, []string{"watcher"})
+
+	watcherQueueDropped = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "watcher_queue_dropped_total",
+		Help:      "Number of events dropped or coalesced by the full queue of each watcher",
+	}, []string{"watcher"})
+
+	certificateExpiry = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "certificate_expiry_timestamp_seconds",
+		Help:      "Expiry of the webhook server certificates, as a unix timestamp",
+	}, []string{"certificate"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(
+		admissionRequests,
+		admissionDuration,
+		admissionPatchSize,
+		chainExtensionRequests,
+		chainExtensionDuration,
+		watcherEvents,
+		watcherRestarts,
+		watcherQueueDepth,
+		watcherQueueDropped,
+		certificateExpiry,
+	)
+}
+
+// admissionResult returns the result label of an admission response
+func admissionResult(res admission.Response) string {
+	switch {
+	case res.Allowed:
+		return "allowed"
+	case res.Result != nil && res.Result.Code == http.StatusForbidden:
+		return "denied"
+	}
+	return "errored"
+}
+
+// observeAdmission records the response of the webhook to the request
+func (w *admissionWebhook) observeAdmission(req admission.Request, res admission.Response) {
+	admissionRequests.WithLabelValues(w.Name, string(req.Operation), admissionResult(res)).Inc()
+	if len(res.Patches) == 0 {
+		return
+	}
+	if patch, err := json.Marshal(res.Patches); err == nil {
+		admissionPatchSize.WithLabelValues(w.Name).Observe(float64(len(patch)))
+	}
+}
+
+// observeAdmissionDuration records the time the webhook took to handle the request since start
+func (w *admissionWebhook) observeAdmissionDuration(req admission.Request, start time.Time) {
+	admissionDuration.WithLabelValues(w.Name, string(req.Operation)).Observe(time.Since(start).Seconds())
+}
+
+// observeChainExtension records the response of the named extension of the chain to the request, handled since start
+func observeChainExtension(chain, extension string, req admission.Request, res admission.Response, start time.Time) {
+	chainExtensionDuration.WithLabelValues(chain, extension, string(req.Operation)).Observe(time.Since(start).Seconds())
+	chainExtensionRequests.WithLabelValues(chain, extension, string(req.Operation), admissionResult(res)).Inc()
+}
+
+// observeWatcherEvent records an event received by the named watcher, see watcherName
+func observeWatcherEvent(watcher string, e watch.Event) {
+	watcherEvents.WithLabelValues(watcher, string(e.Type)).Inc()
+}
+
+// observeCertificateExpiry records the expiry of the CA and of the webhook server certificate
+func (f *WebhookConfig) observeCertificateExpiry() {
+	for name, certificate := range map[string][]byte{"ca": f.CaCertificate, "certificate": f.Certificate} {
+		cert, err := parseCertificate(certificate)
+		if err != nil {
+			continue
+		}
+		certificateExpiry.WithLabelValues(name).Set(float64(cert.NotAfter.Unix()))
+	}
+}
@@ -0,0 +1,128 @@
+package extension_test
+
+import (
+	"context"
+	"encoding/json"
+
+	. "code.cloudfoundry.org/eirinix"
+	catalog "code.cloudfoundry.org/eirinix/testing"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	dto "github.com/prometheus/client_model/go"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+var _ = Describe("Metrics", func() {
+	var (
+		eirinixcatalog catalog.Catalog
+		eiriniManager  *DefaultExtensionManager
+	)
+
+	BeforeEach(func() {
+		eirinixcatalog = catalog.NewCatalog()
+		eiriniManager = eirinixcatalog.SimpleManager().(*DefaultExtensionManager)
+	})
+
+	// metric returns the metric of the family with the given labels, or nil if there is none
+	metric := func(family string, labels map[string]string) *dto.Metric {
+		families, err := metrics.Registry.Gather()
+		Expect(err).ToNot(HaveOccurred())
+		for _, f := range families {
+			if f.GetName() != family {
+				continue
+			}
+		metrics:
+			for _, m := range f.GetMetric() {
+				for _, l := range m.GetLabel() {
+					if v, ok := labels[l.GetName()]; ok && v != l.GetValue() {
+						continue metrics
+					}
+				}
+				return m
+			}
+		}
+		return nil
+	}
+
+	handle := func(id string, e Extension, req admission.Request) admission.Response {
+		failurePolicy := admissionregistrationv1.Fail
+		w := NewWebhook(e, eiriniManager)
+		err := w.RegisterAdmissionWebHook(&webhook.Server{}, WebhookOptions{ID: id, ManagerOptions: ManagerOptions{
+			FailurePolicy:       &failurePolicy,
+			OperatorFingerprint: "eirini-x",
+		}})
+		Expect(err).ToNot(HaveOccurred())
+		decoder, err := admission.NewDecoder(scheme.Scheme)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(w.InjectDecoder(decoder)).To(Succeed())
+		return w.Handle(context.Background(), req)
+	}
+
+	podRequest := func() admission.Request {
+		raw, err := json.Marshal(&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "foo"}})
+		Expect(err).ToNot(HaveOccurred())
+		return admission.Request{AdmissionRequest: admissionv1beta1.AdmissionRequest{
+			Operation: admissionv1beta1.Create,
+			Object:    runtime.RawExtension{Raw: raw},
+		}}
+	}
+
+	It("counts the admission requests per webhook, operation and result", func() {
+		res := handle("metrics-allowed", &catalog.AnnotatePodExtension{Key: "metrics", Value: "yes"}, podRequest())
+		Expect(res.Allowed).To(BeTrue())
+		Expect(res.Patches).ToNot(BeEmpty())
+
+		labels := map[string]string{"webhook": "metrics-allowed.eirini-x.org", "operation": "CREATE", "result": "allowed"}
+		Expect(metric("eirinix_admission_requests_total", labels).GetCounter().GetValue()).To(Equal(1.0))
+		Expect(metric("eirinix_admission_duration_seconds", labels).GetHistogram().GetSampleCount()).To(Equal(uint64(1)))
+		Expect(metric("eirinix_admission_patch_bytes", labels).GetHistogram().GetSampleSum()).To(BeNumerically(">", 0))
+	})
+
+	It("counts the denied requests", func() {
+		req := podRequest()
+		req.Object.Raw = []byte("{")
+		res := handle("metrics-denied", eirinixcatalog.DecodeErrorExtension(), req)
+		Expect(res.Allowed).To(BeFalse())
+
+		labels := map[string]string{"webhook": "metrics-denied.eirini-x.org", "result": "denied"}
+		Expect(metric("eirinix_admission_requests_total", labels).GetCounter().GetValue()).To(Equal(1.0))
+	})
+
+	It("counts the requests per extension of the chains", func() {
+		chain := NewExtensionChain("metrics-chain",
+			&catalog.AnnotatePodExtension{Key: "metrics", Value: "yes"},
+			eirinixcatalog.NamedExtension("metrics-named"),
+		)
+		res := handle("metrics-chain", chain, podRequest())
+		Expect(res.Allowed).To(BeFalse())
+
+		for extension, result := range map[string]string{"0": "allowed", "metrics-named": "errored"} {
+			labels := map[string]string{"chain": "metrics-chain", "extension": extension, "operation": "CREATE", "result": result}
+			Expect(metric("eirinix_chain_extension_requests_total", labels).GetCounter().GetValue()).To(Equal(1.0))
+			Expect(metric("eirinix_chain_extension_duration_seconds", labels).GetHistogram().GetSampleCount()).To(Equal(uint64(1)))
+		}
+	})
+
+	It("counts the events per watcher and type", func() {
+		release := make(chan struct{})
+		close(release)
+		eiriniManager.Watchers = []Watcher{eirinixcatalog.SimpleWatcher(), &slowWatcher{name: "metrics-watcher", release: release}}
+		named := map[string]string{"watcher": "metrics-watcher", "type": "DELETED"}
+		indexed := map[string]string{"watcher": "0", "type": "DELETED"}
+		before := metric("eirinix_watcher_events_total", named).GetCounter().GetValue()
+		beforeIndexed := metric("eirinix_watcher_events_total", indexed).GetCounter().GetValue()
+
+		eiriniManager.HandleEvent(watch.Event{Type: watch.Deleted, Object: &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "foo"}}})
+		Expect(metric("eirinix_watcher_events_total", named).GetCounter().GetValue()).To(Equal(before + 1))
+		Expect(metric("eirinix_watcher_events_total", indexed).GetCounter().GetValue()).To(Equal(beforeIndexed + 1))
+	})
+})
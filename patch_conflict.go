@@ -0,0 +1,142 @@
+package extension
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gomodules.xyz/jsonpatch/v2"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// PatchConflictPolicy defines what happens when two extensions of a chain patch the same paths
+type PatchConflictPolicy string
+
+const (
+	// PatchConflictPolicyLog logs the conflicts and admits the merged patch. It is the default.
+	PatchConflictPolicyLog PatchConflictPolicy = "Log"
+	// PatchConflictPolicyFail rejects the request with an error
+	PatchConflictPolicyFail PatchConflictPolicy = "Fail"
+	// PatchConflictPolicyIgnore doesn't look for conflicts
+	PatchConflictPolicyIgnore PatchConflictPolicy = "Ignore"
+)
+
+// PatchConflict describes two extensions whose patches write the same JSON pointer path,
+// or a path and one of its children. The objects and arrays added or replaced by a patch are compared
+// by their leaves, so that extensions adding different keys to the same map don't conflict.
+type PatchConflict struct {
+	// First and Second are the indexes of the conflicting extensions
+	First, Second int
+	// FirstPath and SecondPath are the conflicting paths patched by each extension
+	FirstPath, SecondPath string
+}
+
+func (c PatchConflict) String() string {
+	if c.FirstPath == c.SecondPath {
+		return fmt.Sprintf("extensions %d and %d both patch %s", c.First, c.Second, c.FirstPath)
+	}
+	return fmt.Sprintf("extension %d patches %s and extension %d patches %s", c.First, c.FirstPath, c.Second, c.SecondPath)
+}
+
+// FindPatchConflicts returns the conflicts between the patches of several extensions.
+// The patches are given in the order of the extensions, one slice per extension.
+func FindPatchConflicts(patches [][]jsonpatch.JsonPatchOperation) []PatchConflict {
+	var conflicts []PatchConflict
+	for i := range patches {
+		for j := i + 1; j < len(patches); j++ {
+			conflicts = append(conflicts, findConflicts(i, j, patches[i], patches[j])...)
+		}
+	}
+	return conflicts
+}
+
+func findConflicts(first, second int, a, b []jsonpatch.JsonPatchOperation) []PatchConflict {
+	var conflicts []PatchConflict
+	seen := map[PatchConflict]bool{}
+	pathsA, pathsB := patchedPaths(a), patchedPaths(b)
+	for _, pa := range pathsA {
+		for _, pb := range pathsB {
+			if !overlappingPaths(pa, pb) {
+				continue
+			}
+			c := PatchConflict{First: first, Second: second, FirstPath: pa, SecondPath: pb}
+			if !seen[c] {
+				seen[c] = true
+				conflicts = append(conflicts, c)
+			}
+		}
+	}
+	return conflicts
+}
+
+// patchedPaths returns the paths written by the operations: the leaves of the values they add or replace,
+// or their path for the other operations and the scalar values
+func patchedPaths(operations []jsonpatch.JsonPatchOperation) []string {
+	var paths []string
+	for _, op := range operations {
+		if op.Operation != "add" && op.Operation != "replace" {
+			paths = append(paths, op.Path)
+			continue
+		}
+		// The values are compared in their JSON form, whatever the type the extension patched with
+		var value interface{}
+		if raw, err := json.Marshal(op.Value); err == nil && json.Unmarshal(raw, &value) == nil {
+			paths = append(paths, leafPaths(op.Path, value)...)
+		} else {
+			paths = append(paths, op.Path)
+		}
+	}
+	return paths
+}
+
+// leafPaths returns the paths of the leaves of the JSON value at the path, in order
+func leafPaths(path string, value interface{}) []string {
+	var paths []string
+	switch v := value.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			paths = append(paths, leafPaths(path+"/"+pointerEscaper.Replace(key), v[key])...)
+		}
+	case []interface{}:
+		for i, item := range v {
+			paths = append(paths, leafPaths(path+"/"+strconv.Itoa(i), item)...)
+		}
+	}
+	if len(paths) == 0 {
+		return []string{path}
+	}
+	return paths
+}
+
+// pointerEscaper escapes a key in a JSON pointer, see RFC 6901
+var pointerEscaper = strings.NewReplacer("~", "~0", "/", "~1")
+
+// overlappingPaths returns true if the paths are equal or if one is the parent of the other
+func overlappingPaths(a, b string) bool {
+	if a == b {
+		return true
+	}
+	if len(a) > len(b) {
+		a, b = b, a
+	}
+	return strings.HasPrefix(b, a+"/")
+}
+
+// ResponsePatches returns the JSON patch operations of an admission response, from its Patches or its raw Patch
+func ResponsePatches(res admission.Response) ([]jsonpatch.JsonPatchOperation, error) {
+	if len(res.Patches) > 0 || len(res.Patch) == 0 {
+		return res.Patches, nil
+	}
+	var patches []jsonpatch.JsonPatchOperation
+	if err := json.Unmarshal(res.Patch, &patches); err != nil {
+		return nil, err
+	}
+	return patches, nil
+}
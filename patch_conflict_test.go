@@ -0,0 +1,200 @@
+package extension_test
+
+import (
+	"context"
+	"encoding/json"
+
+	. "code.cloudfoundry.org/eirinix"
+	catalog "code.cloudfoundry.org/eirinix/testing"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"gomodules.xyz/jsonpatch/v2"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+var _ = Describe("Patch conflicts", func() {
+	op := func(path string) jsonpatch.JsonPatchOperation {
+		return jsonpatch.NewOperation("add", path, "value")
+	}
+
+	It("finds extensions patching the same path", func() {
+		conflicts := FindPatchConflicts([][]jsonpatch.JsonPatchOperation{
+			{op("/metadata/labels")},
+			{op("/spec/containers/0/env")},
+			{op("/spec/containers/0/env")},
+		})
+		Expect(conflicts).To(Equal([]PatchConflict{{First: 1, Second: 2, FirstPath: "/spec/containers/0/env", SecondPath: "/spec/containers/0/env"}}))
+		Expect(conflicts[0].String()).To(Equal("extensions 1 and 2 both patch /spec/containers/0/env"))
+	})
+
+	It("finds extensions patching a path and its children", func() {
+		conflicts := FindPatchConflicts([][]jsonpatch.JsonPatchOperation{
+			{op("/spec/containers/0/env/1")},
+			{op("/spec/containers/0/env")},
+		})
+		Expect(conflicts).To(HaveLen(1))
+		Expect(conflicts[0].String()).To(Equal("extension 0 patches /spec/containers/0/env/1 and extension 1 patches /spec/containers/0/env"))
+	})
+
+	It("compares the leaves of the objects added", func() {
+		add := func(path string, value interface{}) jsonpatch.JsonPatchOperation {
+			return jsonpatch.NewOperation("add", path, value)
+		}
+		Expect(FindPatchConflicts([][]jsonpatch.JsonPatchOperation{
+			{add("/metadata/annotations", map[string]string{"a": "x"})},
+			{add("/metadata/annotations/b", "y")},
+		})).To(BeEmpty())
+
+		conflicts := FindPatchConflicts([][]jsonpatch.JsonPatchOperation{
+			{add("/metadata/annotations", map[string]string{"eirinix.io/a": "x"})},
+			{add("/metadata/annotations/eirinix.io~1a", "y")},
+		})
+		Expect(conflicts).To(HaveLen(1))
+		Expect(conflicts[0].String()).To(Equal("extensions 0 and 1 both patch /metadata/annotations/eirinix.io~1a"))
+	})
+
+	It("reports the removal of a path patched by another extension", func() {
+		conflicts := FindPatchConflicts([][]jsonpatch.JsonPatchOperation{
+			{jsonpatch.NewOperation("add", "/metadata/annotations", map[string]string{"a": "x"})},
+			{jsonpatch.NewOperation("remove", "/metadata/annotations", nil)},
+		})
+		Expect(conflicts).To(HaveLen(1))
+		Expect(conflicts[0].String()).To(Equal("extension 0 patches /metadata/annotations/a and extension 1 patches /metadata/annotations"))
+	})
+
+	It("doesn't report paths sharing a prefix only", func() {
+		Expect(FindPatchConflicts([][]jsonpatch.JsonPatchOperation{
+			{op("/metadata/labels")},
+			{op("/metadata/labelsfoo")},
+		})).To(BeEmpty())
+	})
+
+	Context("in a chain", func() {
+		var (
+			eiriniManager *DefaultExtensionManager
+			req           admission.Request
+			pod           *corev1.Pod
+		)
+
+		BeforeEach(func() {
+			eirinixcatalog := catalog.NewCatalog()
+			eiriniManager, _ = eirinixcatalog.SimpleManager().(*DefaultExtensionManager)
+			pod = &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "app", Annotations: map[string]string{"foo": "bar"}}}
+			raw, err := json.Marshal(pod)
+			Expect(err).ToNot(HaveOccurred())
+			req = admission.Request{AdmissionRequest: admissionv1beta1.AdmissionRequest{Object: runtime.RawExtension{Raw: raw}}}
+		})
+
+		conflictingChain := func() *ExtensionChain {
+			return NewExtensionChain("chain",
+				&catalog.AnnotatePodExtension{Key: "order", Value: "first"},
+				&catalog.AnnotatePodExtension{Key: "order", Value: "second"},
+			)
+		}
+
+		It("admits the merged patch by default", func() {
+			res := conflictingChain().Handle(context.Background(), eiriniManager, pod, req)
+			Expect(res.Allowed).To(BeTrue())
+		})
+
+		It("fails with the Fail policy", func() {
+			chain := conflictingChain()
+			chain.ConflictPolicy = PatchConflictPolicyFail
+			res := chain.Handle(context.Background(), eiriniManager, pod, req)
+			Expect(res.Allowed).To(BeFalse())
+			Expect(res.Result.Message).To(Equal("Conflicting patches in chain chain: extensions 0 and 1 both patch /metadata/annotations/order"))
+		})
+
+		It("uses the policy of the manager", func() {
+			eiriniManager.Options.PatchConflictPolicy = PatchConflictPolicyFail
+			res := conflictingChain().Handle(context.Background(), eiriniManager, pod, req)
+			Expect(res.Allowed).To(BeFalse())
+		})
+
+		Context("on a pod without annotations", func() {
+			BeforeEach(func() {
+				pod = &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "app"}}
+				raw, err := json.Marshal(pod)
+				Expect(err).ToNot(HaveOccurred())
+				req.Object.Raw = raw
+			})
+
+			It("admits extensions adding different annotations", func() {
+				chain := NewExtensionChain("chain",
+					&catalog.AnnotatePodExtension{Key: "a", Value: "x"},
+					&catalog.AnnotatePodExtension{Key: "b", Value: "y"},
+				)
+				chain.ConflictPolicy = PatchConflictPolicyFail
+				res := chain.Handle(context.Background(), eiriniManager, pod, req)
+				Expect(res.Allowed).To(BeTrue())
+				Expect(res.Patches).To(HaveLen(1))
+				Expect(res.Patches[0].Value).To(Equal(map[string]interface{}{"a": "x", "b": "y"}))
+			})
+
+			It("fails with extensions adding the same annotation", func() {
+				chain := conflictingChain()
+				chain.ConflictPolicy = PatchConflictPolicyFail
+				res := chain.Handle(context.Background(), eiriniManager, pod, req)
+				Expect(res.Allowed).To(BeFalse())
+				Expect(res.Result.Message).To(Equal("Conflicting patches in chain chain: extensions 0 and 1 both patch /metadata/annotations/order"))
+			})
+		})
+	})
+
+	Context("in the testing package", func() {
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "app"},
+			Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "opi"}}},
+		}
+
+		It("accepts compatible extensions", func() {
+			Expect(catalog.CheckExtensionsCompatible(pod,
+				&catalog.EditEnvExtension{},
+				&catalog.AnnotatePodExtension{Key: "touched", Value: "yes"},
+			)).To(Succeed())
+		})
+
+		It("accepts extensions adding different annotations", func() {
+			Expect(catalog.CheckExtensionsCompatible(pod,
+				&catalog.AnnotatePodExtension{Key: "a", Value: "x"},
+				&catalog.AnnotatePodExtension{Key: "b", Value: "y"},
+			)).To(Succeed())
+		})
+
+		It("reports the conflicting extensions", func() {
+			err := catalog.CheckExtensionsCompatible(pod,
+				&catalog.AnnotatePodExtension{Key: "touched", Value: "yes"},
+				&catalog.AnnotatePodExtension{Key: "touched", Value: "no"},
+			)
+			Expect(err).To(MatchError("Conflicting patches: extensions 0 and 1 both patch /metadata/annotations/touched"))
+		})
+
+		It("reads the raw patches of the responses", func() {
+			err := catalog.CheckExtensionsCompatible(pod,
+				&catalog.AnnotatePodExtension{Key: "touched", Value: "yes"},
+				&rawPatchExtension{&catalog.AnnotatePodExtension{Key: "touched", Value: "no"}},
+			)
+			Expect(err).To(MatchError("Conflicting patches: extensions 0 and 1 both patch /metadata/annotations/touched"))
+		})
+	})
+})
+
+// rawPatchExtension returns the patches of the Extension as a raw JSON patch
+type rawPatchExtension struct {
+	Extension
+}
+
+func (e *rawPatchExtension) Handle(ctx context.Context, m Manager, pod *corev1.Pod, req admission.Request) admission.Response {
+	res := e.Extension.Handle(ctx, m, pod, req)
+	raw, err := json.Marshal(res.Patches)
+	Expect(err).ToNot(HaveOccurred())
+	patchType := admissionv1beta1.PatchTypeJSONPatch
+	res.Patches = nil
+	res.Patch = raw
+	res.PatchType = &patchType
+	return res
+}
@@ -0,0 +1,77 @@
+package extension
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// wrappedExtension is implemented by the adapters which turn typed Extensions into ResourceExtensions,
+// and Watchers into ResourceWatchers
+type wrappedExtension interface {
+	unwrap() interface{}
+}
+
+// unwrapExtension returns the Extension or the Watcher added by the user, which is checked for the optional interfaces
+func unwrapExtension(e interface{}) interface{} {
+	if w, ok := e.(wrappedExtension); ok {
+		return w.unwrap()
+	}
+	return e
+}
+
+type statefulSetExtension struct {
+	extension StatefulSetExtension
+}
+
+// NewStatefulSetExtension returns a ResourceExtension out of a StatefulSetExtension
+func NewStatefulSetExtension(e StatefulSetExtension) ResourceExtension {
+	return &statefulSetExtension{extension: e}
+}
+
+func (e *statefulSetExtension) GroupVersionKind() schema.GroupVersionKind {
+	return appsv1.SchemeGroupVersion.WithKind("StatefulSet")
+}
+
+func (e *statefulSetExtension) Handle(ctx context.Context, m Manager, obj runtime.Object, req admission.Request) admission.Response {
+	statefulSet, ok := obj.(*appsv1.StatefulSet)
+	if !ok {
+		return admission.Errored(http.StatusBadRequest, fmt.Errorf("Expected a StatefulSet, got %T", obj))
+	}
+	return e.extension.Handle(ctx, m, statefulSet, req)
+}
+
+func (e *statefulSetExtension) unwrap() interface{} {
+	return e.extension
+}
+
+type jobExtension struct {
+	extension JobExtension
+}
+
+// NewJobExtension returns a ResourceExtension out of a JobExtension
+func NewJobExtension(e JobExtension) ResourceExtension {
+	return &jobExtension{extension: e}
+}
+
+func (e *jobExtension) GroupVersionKind() schema.GroupVersionKind {
+	return batchv1.SchemeGroupVersion.WithKind("Job")
+}
+
+func (e *jobExtension) Handle(ctx context.Context, m Manager, obj runtime.Object, req admission.Request) admission.Response {
+	job, ok := obj.(*batchv1.Job)
+	if !ok {
+		return admission.Errored(http.StatusBadRequest, fmt.Errorf("Expected a Job, got %T", obj))
+	}
+	return e.extension.Handle(ctx, m, job, req)
+}
+
+func (e *jobExtension) unwrap() interface{} {
+	return e.extension
+}
@@ -0,0 +1,155 @@
+package extension_test
+
+import (
+	"context"
+	"encoding/json"
+
+	. "code.cloudfoundry.org/eirinix"
+	catalog "code.cloudfoundry.org/eirinix/testing"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+var _ = Describe("Resource extensions", func() {
+	var (
+		eirinixcatalog catalog.Catalog
+		eiriniManager  *DefaultExtensionManager
+		failurePolicy  admissionregistrationv1.FailurePolicyType
+		decoder        *admission.Decoder
+	)
+
+	objectRequest := func(obj runtime.Object) admission.Request {
+		raw, err := json.Marshal(obj)
+		Expect(err).ToNot(HaveOccurred())
+		return admission.Request{AdmissionRequest: admissionv1beta1.AdmissionRequest{Object: runtime.RawExtension{Raw: raw}}}
+	}
+
+	register := func(w MutatingWebhook) {
+		err := w.RegisterAdmissionWebHook(&webhook.Server{}, WebhookOptions{ID: "resource", ManagerOptions: ManagerOptions{FailurePolicy: &failurePolicy, Namespace: "eirini", OperatorFingerprint: "eirini-x"}})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(w.InjectDecoder(decoder)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		var err error
+		eirinixcatalog = catalog.NewCatalog()
+		eiriniManager, _ = eirinixcatalog.SimpleManager().(*DefaultExtensionManager)
+		failurePolicy = admissionregistrationv1.Fail
+		decoder, err = admission.NewDecoder(scheme.Scheme)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	Context("StatefulSet extensions", func() {
+		var w MutatingWebhook
+
+		BeforeEach(func() {
+			w = NewResourceWebhook(NewStatefulSetExtension(&catalog.AnnotateStatefulSetExtension{}), eiriniManager)
+			register(w)
+		})
+
+		It("derives the rules from the kind", func() {
+			Expect(w.GetRules()).To(HaveLen(1))
+			Expect(w.GetRules()[0].Rule.APIGroups).To(Equal([]string{"apps"}))
+			Expect(w.GetRules()[0].Rule.APIVersions).To(Equal([]string{"v1"}))
+			Expect(w.GetRules()[0].Rule.Resources).To(Equal([]string{"statefulsets"}))
+		})
+
+		It("passes the decoded StatefulSet to the extension", func() {
+			res := w.Handle(context.Background(), objectRequest(&appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{Name: "app"}}))
+			Expect(res.Allowed).To(BeTrue())
+			Expect(res.Patches).To(HaveLen(1))
+			Expect(res.Patches[0].Path).To(Equal("/metadata/annotations"))
+		})
+
+		It("rejects requests which can't be decoded", func() {
+			res := w.Handle(context.Background(), admission.Request{})
+			Expect(res.Allowed).To(BeFalse())
+			Expect(res.Result.Code).To(Equal(int32(400)))
+		})
+	})
+
+	Context("Job extensions", func() {
+		It("derives the rules from the kind", func() {
+			w := NewResourceWebhook(NewJobExtension(&catalog.AnnotateJobExtension{}), eiriniManager)
+			register(w)
+			Expect(w.GetRules()[0].Rule.APIGroups).To(Equal([]string{"batch"}))
+			Expect(w.GetRules()[0].Rule.Resources).To(Equal([]string{"jobs"}))
+
+			res := w.Handle(context.Background(), objectRequest(&batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: "staging"}}))
+			Expect(res.Patches).To(HaveLen(1))
+		})
+
+		It("is called for the staging Jobs, which aren't labelled as Eirini apps", func() {
+			w := NewResourceWebhook(NewJobExtension(&catalog.AnnotateJobExtension{}), eiriniManager)
+			filter := true
+			err := w.RegisterAdmissionWebHook(&webhook.Server{}, WebhookOptions{ID: "staging", ManagerOptions: ManagerOptions{FailurePolicy: &failurePolicy, Namespace: "eirini", OperatorFingerprint: "eirini-x", FilterEiriniApps: &filter}})
+			Expect(err).ToNot(HaveOccurred())
+
+			// A nil object selector selects all the Jobs, including the ones labelled as staging
+			Expect(w.GetLabelSelector()).To(BeNil())
+		})
+
+		It("filters the Eirini apps if its options ask for it", func() {
+			filter := true
+			w := NewResourceWebhook(NewJobExtension(&catalog.AnnotateJobExtension{}), eiriniManager)
+			err := w.RegisterAdmissionWebHook(&webhook.Server{}, WebhookOptions{ID: "apps", ManagerOptions: ManagerOptions{FailurePolicy: &failurePolicy, Namespace: "eirini", OperatorFingerprint: "eirini-x"}, AdmissionOptions: AdmissionOptions{FilterEiriniApps: &filter}})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(w.GetLabelSelector().MatchLabels).To(Equal(map[string]string{LabelSourceType: "APP"}))
+		})
+	})
+
+	Context("Extensions for kinds unknown to the scheme", func() {
+		It("receives unstructured objects", func() {
+			gvk := schema.GroupVersionKind{Group: "example.org", Version: "v1alpha1", Kind: "Widget"}
+			var received runtime.Object
+			w := NewResourceWebhook(&resourceExtensionFunc{gvk: gvk, handle: func(obj runtime.Object) {
+				received = obj
+			}}, eiriniManager)
+			register(w)
+			Expect(w.GetRules()[0].Rule.Resources).To(Equal([]string{"widgets"}))
+
+			u := &unstructured.Unstructured{}
+			u.SetGroupVersionKind(gvk)
+			u.SetName("widget")
+			w.Handle(context.Background(), objectRequest(u))
+
+			Expect(received).To(BeAssignableToTypeOf(&unstructured.Unstructured{}))
+			Expect(received.(*unstructured.Unstructured).GetName()).To(Equal("widget"))
+		})
+	})
+
+	Context("registered through the manager", func() {
+		It("accepts the typed extensions", func() {
+			Expect(eiriniManager.AddExtension(&catalog.AnnotateStatefulSetExtension{})).To(Succeed())
+			Expect(eiriniManager.AddExtension(&catalog.AnnotateJobExtension{})).To(Succeed())
+			Expect(eiriniManager.ListResourceExtensions()).To(HaveLen(2))
+			Expect(eiriniManager.ListResourceExtensions()[0].GroupVersionKind().Kind).To(Equal("StatefulSet"))
+			Expect(eiriniManager.ListResourceExtensions()[1].GroupVersionKind().Kind).To(Equal("Job"))
+		})
+	})
+})
+
+type resourceExtensionFunc struct {
+	gvk    schema.GroupVersionKind
+	handle func(runtime.Object)
+}
+
+func (e *resourceExtensionFunc) GroupVersionKind() schema.GroupVersionKind {
+	return e.gvk
+}
+
+func (e *resourceExtensionFunc) Handle(ctx context.Context, m Manager, obj runtime.Object, req admission.Request) admission.Response {
+	e.handle(obj)
+	return admission.Allowed("")
+}
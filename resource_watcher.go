@@ -0,0 +1,284 @@
+package extension
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/pkg/errors"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/cache"
+	watchtools "k8s.io/client-go/tools/watch"
+)
+
+// WatchOptions declare the resources a ResourceWatcher receives the events of.
+// The resources are watched in the Namespace of the Manager, or in all the namespaces if it's empty.
+type WatchOptions struct {
+	// Resource is the resource to watch, e.g. appsv1.SchemeGroupVersion.WithResource("statefulsets").
+	// It is ignored if Object is set.
+	Resource schema.GroupVersionResource
+
+	// Object is an object of the kind to watch, e.g. &appsv1.StatefulSet{}. The events then carry objects
+	// of the same type, instead of *unstructured.Unstructured ones.
+	Object runtime.Object
+
+	// LabelSelector restricts the events to the resources matching it
+	LabelSelector string
+
+	// FieldSelector restricts the events to the resources matching it
+	FieldSelector string
+}
+
+// resource returns the resource to watch
+func (o WatchOptions) resource() (schema.GroupVersionResource, error) {
+	if o.Object == nil {
+		if o.Resource.Resource == "" {
+			return schema.GroupVersionResource{}, errors.New("The watcher doesn't declare the resource it watches")
+		}
+		return o.Resource, nil
+	}
+
+	kinds, _, err := scheme.Scheme.ObjectKinds(o.Object)
+	if err != nil {
+		return schema.GroupVersionResource{}, errors.Wrapf(err, "getting the kind of the watched %T", o.Object)
+	}
+	resource, _ := meta.UnsafeGuessKindToResource(kinds[0])
+	return resource, nil
+}
+
+type resourceWatcher struct {
+	watcher Watcher
+	options WatchOptions
+}
+
+// NewResourceWatcher returns a ResourceWatcher which passes the events of the resources declared by
+// the options to the Watcher. The name and the queue options of the Watcher, if it is Named or a
+// QueuedWatcher, are used for the ResourceWatcher.
+func NewResourceWatcher(w Watcher, o WatchOptions) ResourceWatcher {
+	return &resourceWatcher{watcher: w, options: o}
+}
+
+func (w *resourceWatcher) Handle(m Manager, e watch.Event) {
+	w.watcher.Handle(m, e)
+}
+
+func (w *resourceWatcher) WatchOptions() WatchOptions {
+	return w.options
+}
+
+// unwrap returns the Watcher, which is checked for the optional interfaces, e.g. Named and QueuedWatcher
+func (w *resourceWatcher) unwrap() interface{} {
+	return w.watcher
+}
+
+// watchKey identifies a watch, shared by the ResourceWatchers asking for the same resource and selectors
+type watchKey struct {
+	resource      schema.GroupVersionResource
+	labelSelector string
+	fieldSelector string
+}
+
+func (k watchKey) String() string {
+	s := k.resource.GroupResource().String()
+	if k.labelSelector != "" {
+		s += fmt.Sprintf(" (labels %s)", k.labelSelector)
+	}
+	if k.fieldSelector != "" {
+		s += fmt.Sprintf(" (fields %s)", k.fieldSelector)
+	}
+	return s
+}
+
+// resourceWatch is the watch of a resource, dispatching its events to the ResourceWatchers which asked for them
+type resourceWatch struct {
+	key      watchKey
+	watchers []ResourceWatcher
+	// indexes are the indexes of the watchers in the Watchers of the Manager
+	indexes []int
+
+	checkpoint *watchCheckpoint
+
+	watcher watch.Interface
+	stopped bool
+	mutex   sync.Mutex
+}
+
+// stop stops the current watch, which makes watchResource return, and the watches started afterwards
+func (w *resourceWatch) stop() {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.stopped = true
+	if w.watcher != nil {
+		w.watcher.Stop()
+	}
+}
+
+// podWatchers returns the Watchers of the pods of the Namespace, which didn't declare a resource
+func (m *DefaultExtensionManager) podWatchers() []Watcher {
+	var watchers []Watcher
+	for _, w := range m.Watchers {
+		if _, ok := w.(ResourceWatcher); !ok {
+			watchers = append(watchers, w)
+		}
+	}
+	return watchers
+}
+
+// resourceWatches groups the ResourceWatchers by the resource and the selectors they watch
+func (m *DefaultExtensionManager) resourceWatches() ([]*resourceWatch, error) {
+	var watches []*resourceWatch
+	byKey := map[watchKey]*resourceWatch{}
+	for i, w := range m.Watchers {
+		rw, ok := w.(ResourceWatcher)
+		if !ok {
+			continue
+		}
+		options := rw.WatchOptions()
+		resource, err := options.resource()
+		if err != nil {
+			return nil, err
+		}
+		key := watchKey{resource: resource, labelSelector: options.LabelSelector, fieldSelector: options.FieldSelector}
+		if _, ok := byKey[key]; !ok {
+			byKey[key] = &resourceWatch{key: key}
+			watches = append(watches, byKey[key])
+		}
+		byKey[key].watchers = append(byKey[key].watchers, rw)
+		byKey[key].indexes = append(byKey[key].indexes, i)
+	}
+	return watches, nil
+}
+
+// watchPolicyRules returns the permissions the watchers need on the resources they watch
+func (m *DefaultExtensionManager) watchPolicyRules() ([]rbacv1.PolicyRule, error) {
+	rules := []rbacv1.PolicyRule{podsPolicyRule()}
+	watches, err := m.resourceWatches()
+	if err != nil {
+		return nil, err
+	}
+	seen := map[schema.GroupResource]bool{{Resource: "pods"}: true}
+	for _, w := range watches {
+		resource := w.key.resource.GroupResource()
+		if seen[resource] {
+			continue
+		}
+		seen[resource] = true
+		rules = append(rules, rbacv1.PolicyRule{
+			APIGroups: []string{resource.Group},
+			Resources: []string{resource.Resource},
+			Verbs:     []string{"get", "list", "watch"},
+		})
+	}
+	return rules, nil
+}
+
+// GetDynamicClient returns a kubernetes dynamic client from the rest config used.
+func (m *DefaultExtensionManager) GetDynamicClient() (dynamic.Interface, error) {
+	if m.dynamicClient == nil {
+		if m.kubeConnection == nil {
+			if _, err := m.GetKubeConnection(); err != nil {
+				return nil, err
+			}
+		}
+		client, err := dynamic.NewForConfig(m.kubeConnection)
+		if err != nil {
+			return nil, errors.Wrap(err, "Could not get dynamic client")
+		}
+		m.dynamicClient = client
+	}
+
+	return m.dynamicClient, nil
+}
+
+// SetDynamicClient sets the kube dynamic client from a given one
+func (m *DefaultExtensionManager) SetDynamicClient(c dynamic.Interface) {
+	m.dynamicClient = c
+}
+
+// genResourceWatcher generates a watcher of the resources selected by the key, starting from the ResourceVersion
+// of the checkpoint, or from their current list, and tracking its events in the checkpoint
+func (m *DefaultExtensionManager) genResourceWatcher(client dynamic.Interface, key watchKey, checkpoint *watchCheckpoint) (watch.Interface, error) {
+	resourceInterface := client.Resource(key.resource).Namespace(m.Options.Namespace)
+
+	startResourceVersion := checkpoint.resume()
+	if startResourceVersion == "" {
+		listOptions := metav1.ListOptions{LabelSelector: key.labelSelector, FieldSelector: key.fieldSelector}
+		list, err := resourceInterface.List(m.Context, listOptions)
+		if err != nil {
+			return nil, err
+		}
+		startResourceVersion = list.GetResourceVersion()
+	}
+
+	ctx := m.Context
+	return watchtools.NewRetryWatcher(startResourceVersion, &cache.ListWatch{
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			options.Watch = true
+			options.LabelSelector = key.labelSelector
+			options.FieldSelector = key.fieldSelector
+			options.AllowWatchBookmarks = checkpoint != nil
+
+			w, err := resourceInterface.Watch(ctx, options)
+			if err != nil {
+				return nil, err
+			}
+			return checkpoint.track(w), nil
+		}})
+}
+
+// watchResource watches the resources of w until the watch channel closes, and dispatches the events to its watchers
+func (m *DefaultExtensionManager) watchResource(w *resourceWatch) error {
+	client, err := m.GetDynamicClient()
+	if err != nil {
+		return err
+	}
+	watcher, err := m.genResourceWatcher(client, w.key, w.checkpoint)
+	if err != nil {
+		return err
+	}
+
+	w.mutex.Lock()
+	if w.watcher != nil {
+		watcherRestarts.Inc()
+	}
+	w.watcher = watcher
+	if w.stopped {
+		watcher.Stop()
+	}
+	w.mutex.Unlock()
+
+	for e := range watcher.ResultChan() {
+		t := w.checkpoint.dispatch(e)
+		m.dispatchEvent(w, e, t)
+		t.handled()
+	}
+
+	return &WatcherChannelClosedError{"Watcher channel closed"}
+}
+
+// dispatchEvent passes the event to the watchers of w selecting it, converting its object to the type they asked for
+func (m *DefaultExtensionManager) dispatchEvent(w *resourceWatch, e watch.Event, t *trackedEvent) {
+	for i, watcher := range w.watchers {
+		if !watcherSelects(watcher, e) {
+			continue
+		}
+		event := e
+		u, isUnstructured := e.Object.(*unstructured.Unstructured)
+		if object := watcher.WatchOptions().Object; object != nil && isUnstructured {
+			typed := object.DeepCopyObject()
+			if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.Object, typed); err != nil {
+				m.Logger.Errorf("Failed converting the %s event of %s to %T: %s", e.Type, w.key, object, err.Error())
+				continue
+			}
+			event.Object = typed
+		}
+		m.deliverEvent(w.indexes[i], watcher, event, t)
+	}
+}
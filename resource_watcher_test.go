@@ -0,0 +1,175 @@
+package extension_test
+
+import (
+	"sync"
+	"time"
+
+	. "code.cloudfoundry.org/eirinix"
+	catalog "code.cloudfoundry.org/eirinix/testing"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+var _ = Describe("Resource watchers", func() {
+	var (
+		eirinixcatalog catalog.Catalog
+		eiriniManager  *DefaultExtensionManager
+		dynamicClient  *dynamicfake.FakeDynamicClient
+		watches        map[string]*watch.FakeWatcher
+		watchesMutex   sync.Mutex
+	)
+
+	statefulSets := appsv1.SchemeGroupVersion.WithResource("statefulsets")
+
+	BeforeEach(func() {
+		eirinixcatalog = catalog.NewCatalog()
+		eiriniManager = eirinixcatalog.SimpleManager().(*DefaultExtensionManager)
+
+		watches = map[string]*watch.FakeWatcher{}
+		dynamicClient = dynamicfake.NewSimpleDynamicClient(runtime.NewScheme())
+		dynamicClient.PrependReactor("list", "statefulsets", func(clienttesting.Action) (bool, runtime.Object, error) {
+			list := &unstructured.UnstructuredList{}
+			list.SetResourceVersion("1")
+			return true, list, nil
+		})
+		dynamicClient.PrependWatchReactor("statefulsets", func(action clienttesting.Action) (bool, watch.Interface, error) {
+			watchesMutex.Lock()
+			defer watchesMutex.Unlock()
+			w := watch.NewFake()
+			watches[action.(clienttesting.WatchAction).GetWatchRestrictions().Labels.String()] = w
+			return true, w, nil
+		})
+		eiriniManager.SetDynamicClient(dynamicClient)
+	})
+
+	// watchFor returns the watch with the given label selector, once it is started
+	watchFor := func(selector string) *watch.FakeWatcher {
+		var w *watch.FakeWatcher
+		Eventually(func() *watch.FakeWatcher {
+			watchesMutex.Lock()
+			defer watchesMutex.Unlock()
+			w = watches[selector]
+			return w
+		}, 5*time.Second).ShouldNot(BeNil())
+		return w
+	}
+
+	statefulSet := func(name string) *unstructured.Unstructured {
+		s := &unstructured.Unstructured{}
+		s.SetAPIVersion("apps/v1")
+		s.SetKind("StatefulSet")
+		s.SetName(name)
+		s.SetResourceVersion("2")
+		return s
+	}
+
+	It("dispatches the events of a resource to the watchers which asked for them", func() {
+		typed := make(chan watch.Event, 1)
+		untyped := make(chan watch.Event, 1)
+		others := make(chan watch.Event, 1)
+		pods := make(chan watch.Event, 1)
+		eiriniManager.AddWatcher(NewResourceWatcher(eirinixcatalog.SimpleWatcherWithChannel(typed), WatchOptions{Object: &appsv1.StatefulSet{}, LabelSelector: "app=foo"}))
+		eiriniManager.AddWatcher(NewResourceWatcher(eirinixcatalog.SimpleWatcherWithChannel(untyped), WatchOptions{Resource: statefulSets, LabelSelector: "app=foo"}))
+		eiriniManager.AddWatcher(NewResourceWatcher(eirinixcatalog.SimpleWatcherWithChannel(others), WatchOptions{Resource: statefulSets, LabelSelector: "app=bar"}))
+		eiriniManager.AddWatcher(eirinixcatalog.SimpleWatcherWithChannel(pods))
+		eiriniManager.HandleEvent(watch.Event{Type: watch.Added, Object: &corev1.Pod{}})
+		Expect(pods).To(Receive())
+		Expect(typed).ToNot(Receive())
+
+		// The pods aren't watched, as there is no cluster to watch them with
+		eiriniManager.Watchers = eiriniManager.Watchers[:3]
+
+		stop := make(chan struct{})
+		done := make(chan error)
+		go func() {
+			done <- eiriniManager.RunWatchers(stop)
+		}()
+
+		watchFor("app=foo").Add(statefulSet("foo"))
+		var event watch.Event
+		Eventually(typed, 5*time.Second).Should(Receive(&event))
+		Expect(event.Type).To(Equal(watch.Added))
+		Expect(event.Object).To(BeAssignableToTypeOf(&appsv1.StatefulSet{}))
+		Expect(event.Object.(*appsv1.StatefulSet).Name).To(Equal("foo"))
+		Eventually(untyped, 5*time.Second).Should(Receive(&event))
+		Expect(event.Object.(*unstructured.Unstructured).GetName()).To(Equal("foo"))
+		Consistently(others).ShouldNot(Receive())
+
+		watchFor("app=bar").Add(statefulSet("bar"))
+		Eventually(others, 5*time.Second).Should(Receive())
+
+		// The watchers asking for the same resource and selectors share the watch
+		Expect(dynamicClient.Actions()).To(HaveLen(4))
+
+		close(stop)
+		Eventually(done, 5*time.Second).Should(Receive(BeNil()))
+	})
+
+	It("uses the name and the queue of the wrapped watcher", func() {
+		slow := &slowWatcher{name: "wrapped", release: make(chan struct{}), options: WatcherQueueOptions{Size: 1, Policy: WatcherQueuePolicyDropOldest}}
+		fast := make(chan watch.Event, 10)
+		eiriniManager.AddWatcher(NewResourceWatcher(slow, WatchOptions{Resource: statefulSets}))
+		eiriniManager.AddWatcher(NewResourceWatcher(eirinixcatalog.SimpleWatcherWithChannel(fast), WatchOptions{Resource: statefulSets}))
+		dropped := queueMetric("eirinix_watcher_queue_dropped_total", "wrapped")
+
+		stop := make(chan struct{})
+		done := make(chan error)
+		go func() {
+			done <- eiriniManager.RunWatchers(stop)
+		}()
+
+		// The slow watcher doesn't hold back the other one, and its full queue drops the oldest events
+		w := watchFor("")
+		w.Add(statefulSet("a"))
+		Eventually(fast, 5*time.Second).Should(Receive())
+		Eventually(func() float64 { return queueMetric("eirinix_watcher_queue_depth", "wrapped") }, 5*time.Second).Should(BeZero())
+		w.Add(statefulSet("b"))
+		Eventually(fast, 5*time.Second).Should(Receive())
+		w.Add(statefulSet("c"))
+		Eventually(fast, 5*time.Second).Should(Receive())
+		Expect(queueMetric("eirinix_watcher_queue_dropped_total", "wrapped")).To(Equal(dropped + 1.0))
+
+		close(slow.release)
+		Eventually(slow.handledCount, 5*time.Second).Should(Equal(2))
+		close(stop)
+		Eventually(done, 5*time.Second).Should(Receive(BeNil()))
+	})
+
+	It("returns the error of a watcher which doesn't declare its resource", func() {
+		eiriniManager.AddWatcher(NewResourceWatcher(eirinixcatalog.SimpleWatcher(), WatchOptions{}))
+		stop := make(chan struct{})
+		defer close(stop)
+		Expect(eiriniManager.RunWatchers(stop)).To(MatchError(ContainSubstring("doesn't declare the resource")))
+	})
+
+	It("grants access to the watched resources", func() {
+		eiriniManager.AddWatcher(NewResourceWatcher(eirinixcatalog.SimpleWatcher(), WatchOptions{Object: &appsv1.StatefulSet{}}))
+		eiriniManager.AddWatcher(NewResourceWatcher(eirinixcatalog.SimpleWatcher(), WatchOptions{Resource: statefulSets, LabelSelector: "app=foo"}))
+		eiriniManager.AddWatcher(NewResourceWatcher(eirinixcatalog.SimpleWatcher(), WatchOptions{Object: &corev1.Event{}}))
+
+		objects, err := eiriniManager.Manifests()
+		Expect(err).ToNot(HaveOccurred())
+		var role *rbacv1.Role
+		for _, o := range objects {
+			if r, ok := o.(*rbacv1.Role); ok && r.Namespace == eiriniManager.Options.Namespace {
+				role = r
+			}
+		}
+		Expect(role).ToNot(BeNil())
+		Expect(role.Rules).To(HaveLen(3))
+		Expect(role.Rules[1]).To(Equal(rbacv1.PolicyRule{
+			APIGroups: []string{"apps"},
+			Resources: []string{"statefulsets"},
+			Verbs:     []string{"get", "list", "watch"},
+		}))
+		Expect(role.Rules[2].Resources).To(Equal([]string{"events"}))
+	})
+})
@@ -0,0 +1,148 @@
+package extension
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// WatchSelector selects the objects a Watcher receives the events of. A nil selector selects all the objects.
+type WatchSelector struct {
+	Labels labels.Selector
+	Fields fields.Selector
+}
+
+// SelectorProvider is an optional interface a Watcher can implement to receive only the events of the
+// objects matching its selector, e.g. the pods labelled with LabelProcessType=web.
+//
+// The requirements shared by all the Watchers of a watch are added to the watch request, and the events
+// are matched against the selector of each Watcher before being passed to it. The objects are matched as
+// they are in the event: a Watcher doesn't receive the event of an object which stops matching its selector.
+type SelectorProvider interface {
+	Selector() WatchSelector
+}
+
+// watcherSelects tells if the object of the event is selected by the Watcher. The events without
+// an object, e.g. the errors, are passed to all the Watchers.
+func watcherSelects(w Watcher, e watch.Event) bool {
+	provider, ok := w.(SelectorProvider)
+	if !ok {
+		return true
+	}
+	object, err := meta.Accessor(e.Object)
+	if err != nil {
+		return true
+	}
+
+	selector := provider.Selector()
+	if selector.Labels != nil && !selector.Labels.Matches(labels.Set(object.GetLabels())) {
+		return false
+	}
+	if selector.Fields != nil && !selector.Fields.Matches(objectFields(e.Object)) {
+		return false
+	}
+	return true
+}
+
+// objectFields returns the fields of the object which can be selected, as served by the API server
+func objectFields(obj runtime.Object) fields.Set {
+	object, err := meta.Accessor(obj)
+	if err != nil {
+		return fields.Set{}
+	}
+	set := fields.Set{
+		"metadata.name":      object.GetName(),
+		"metadata.namespace": object.GetNamespace(),
+	}
+	if pod, ok := obj.(*corev1.Pod); ok {
+		set["spec.nodeName"] = pod.Spec.NodeName
+		set["spec.restartPolicy"] = string(pod.Spec.RestartPolicy)
+		set["spec.schedulerName"] = pod.Spec.SchedulerName
+		set["spec.serviceAccountName"] = pod.Spec.ServiceAccountName
+		set["status.phase"] = string(pod.Status.Phase)
+		set["status.podIP"] = pod.Status.PodIP
+		set["status.nominatedNodeName"] = pod.Status.NominatedNodeName
+	}
+	return set
+}
+
+// commonSelector returns the requirements shared by the selectors of all the Watchers, which the watch
+// request can ask for without missing events. It is empty if a Watcher isn't a SelectorProvider.
+func commonSelector(watchers []Watcher) (labels.Selector, fields.Selector) {
+	var labelRequirements []labels.Requirement
+	var fieldRequirements []fields.Requirement
+	for i, w := range watchers {
+		provider, ok := w.(SelectorProvider)
+		if !ok {
+			return labels.Everything(), fields.Everything()
+		}
+		selector := provider.Selector()
+
+		var labelReqs []labels.Requirement
+		if selector.Labels != nil {
+			labelReqs, _ = selector.Labels.Requirements()
+		}
+		var fieldReqs []fields.Requirement
+		if selector.Fields != nil {
+			fieldReqs = selector.Fields.Requirements()
+		}
+
+		if i == 0 {
+			labelRequirements, fieldRequirements = labelReqs, fieldReqs
+			continue
+		}
+		labelRequirements = sharedLabelRequirements(labelRequirements, labelReqs)
+		fieldRequirements = sharedFieldRequirements(fieldRequirements, fieldReqs)
+	}
+
+	var fieldSelectors []fields.Selector
+	for _, r := range fieldRequirements {
+		if r.Operator == selection.NotEquals {
+			fieldSelectors = append(fieldSelectors, fields.OneTermNotEqualSelector(r.Field, r.Value))
+		} else {
+			fieldSelectors = append(fieldSelectors, fields.OneTermEqualSelector(r.Field, r.Value))
+		}
+	}
+	return labels.NewSelector().Add(labelRequirements...), fields.AndSelectors(fieldSelectors...)
+}
+
+// sharedLabelRequirements returns the requirements of a which are also in b
+func sharedLabelRequirements(a, b []labels.Requirement) []labels.Requirement {
+	var shared []labels.Requirement
+	for _, r := range a {
+		for _, other := range b {
+			if r.String() == other.String() {
+				shared = append(shared, r)
+				break
+			}
+		}
+	}
+	return shared
+}
+
+// sharedFieldRequirements returns the requirements of a which are also in b
+func sharedFieldRequirements(a, b []fields.Requirement) []fields.Requirement {
+	var shared []fields.Requirement
+	for _, r := range a {
+		for _, other := range b {
+			if r == other {
+				shared = append(shared, r)
+				break
+			}
+		}
+	}
+	return shared
+}
+
+// withLabelRequirement adds the requirement to the selector, unless it's already there
+func withLabelRequirement(selector labels.Selector, requirement labels.Requirement) labels.Selector {
+	requirements, _ := selector.Requirements()
+	if len(sharedLabelRequirements(requirements, []labels.Requirement{requirement})) > 0 {
+		return selector
+	}
+	return selector.Add(requirement)
+}
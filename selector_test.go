@@ -0,0 +1,114 @@
+package extension_test
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	. "code.cloudfoundry.org/eirinix"
+	catalog "code.cloudfoundry.org/eirinix/testing"
+	cfakes "code.cloudfoundry.org/eirinix/testing/fakes"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+var _ = Describe("Watcher selectors", func() {
+	var (
+		eirinixcatalog catalog.Catalog
+		eiriniManager  *DefaultExtensionManager
+	)
+
+	BeforeEach(func() {
+		eirinixcatalog = catalog.NewCatalog()
+		eiriniManager = eirinixcatalog.SimpleManager().(*DefaultExtensionManager)
+		eiriniManager.Options.WatcherStartRV = "1"
+	})
+
+	selector := func(labelSelector, fieldSelector string) WatchSelector {
+		s := WatchSelector{}
+		if labelSelector != "" {
+			l, err := labels.Parse(labelSelector)
+			Expect(err).ToNot(HaveOccurred())
+			s.Labels = l
+		}
+		if fieldSelector != "" {
+			f, err := fields.ParseSelector(fieldSelector)
+			Expect(err).ToNot(HaveOccurred())
+			s.Fields = f
+		}
+		return s
+	}
+
+	pod := func(processType string, phase corev1.PodPhase) watch.Event {
+		return watch.Event{Type: watch.Added, Object: &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: processType, Labels: map[string]string{LabelProcessType: processType}},
+			Status:     corev1.PodStatus{Phase: phase},
+		}}
+	}
+
+	It("passes to the watchers only the events of the objects they select", func() {
+		web := eirinixcatalog.SelectiveWatcher(selector(LabelProcessType+"=web", ""))
+		running := eirinixcatalog.SelectiveWatcher(selector("", "status.phase=Running"))
+		all := &catalog.SimpleWatch{}
+		eiriniManager.AddWatcher(web)
+		eiriniManager.AddWatcher(running)
+		eiriniManager.AddWatcher(all)
+
+		eiriniManager.HandleEvent(pod("web", corev1.PodPending))
+		eiriniManager.HandleEvent(pod("worker", corev1.PodRunning))
+		eiriniManager.HandleEvent(watch.Event{Type: watch.Error, Object: &metav1.Status{Code: http.StatusGone}})
+
+		Expect(web.Handled).To(HaveLen(2))
+		Expect(web.Handled[0].Object.(*corev1.Pod).Name).To(Equal("web"))
+		Expect(web.Handled[1].Type).To(Equal(watch.Error))
+		Expect(running.Handled).To(HaveLen(2))
+		Expect(running.Handled[0].Object.(*corev1.Pod).Name).To(Equal("worker"))
+		Expect(all.Handled).To(HaveLen(3))
+	})
+
+	Context("when watching the pods", func() {
+		var listOptions chan metav1.ListOptions
+
+		// watchOptions returns the options of the pod watch request
+		watchOptions := func() metav1.ListOptions {
+			listOptions = make(chan metav1.ListOptions, 1)
+			fakeCorev1 := &cfakes.FakeCoreV1Interface{}
+			fakePod := &cfakes.FakePodInterface{}
+			fakePod.WatchCalls(func(_ context.Context, options metav1.ListOptions) (watch.Interface, error) {
+				listOptions <- options
+				return &cfakes.FakeInterface{}, nil
+			})
+			fakeCorev1.PodsReturns(fakePod)
+
+			w, err := eiriniManager.GenWatcher(fakeCorev1)
+			Expect(err).ToNot(HaveOccurred())
+			defer w.Stop()
+			var options metav1.ListOptions
+			Eventually(listOptions, 5*time.Second).Should(Receive(&options))
+			return options
+		}
+
+		It("requests the requirements shared by all the watchers", func() {
+			eiriniManager.AddWatcher(eirinixcatalog.SelectiveWatcher(selector(LabelProcessType+"=web,"+LabelAppGUID+"=foo", "spec.nodeName=node")))
+			eiriniManager.AddWatcher(eirinixcatalog.SelectiveWatcher(selector(LabelProcessType+"=web,"+LabelSourceType+"=APP", "spec.nodeName=node,status.phase=Running")))
+
+			options := watchOptions()
+			Expect(options.LabelSelector).To(Equal(LabelProcessType + "=web," + LabelSourceType + "=APP"))
+			Expect(options.FieldSelector).To(Equal("spec.nodeName=node"))
+		})
+
+		It("requests all the eirini apps if a watcher has no selector", func() {
+			eiriniManager.AddWatcher(eirinixcatalog.SelectiveWatcher(selector(LabelProcessType+"=web", "")))
+			eiriniManager.AddWatcher(eirinixcatalog.SimpleWatcher())
+
+			options := watchOptions()
+			Expect(options.LabelSelector).To(Equal(LabelSourceType + "=APP"))
+			Expect(options.FieldSelector).To(BeEmpty())
+		})
+	})
+})
@@ -9,8 +9,12 @@ import (
 	"strconv"
 
 	eirinix "code.cloudfoundry.org/eirinix"
+	"code.cloudfoundry.org/quarks-utils/pkg/credsgen"
+	inmemorycredgen "code.cloudfoundry.org/quarks-utils/pkg/credsgen/in_memory_generator"
 	"github.com/phayes/freeport"
 	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/watch"
 )
 
@@ -35,6 +39,27 @@ type Catalog struct {
 	KindHost    string
 }
 
+// Certificates returns a CA and a certificate signed by it for the given SubjectAltNames,
+// both expiring in the given number of days
+func (c *Catalog) Certificates(expiry int, sans ...string) (credsgen.Certificate, credsgen.Certificate, error) {
+	generator := inmemorycredgen.NewInMemoryGenerator(zap.NewNop().Sugar())
+	generator.Expiry = expiry
+
+	ca, err := generator.GenerateCertificate("ca", credsgen.CertificateGenerationRequest{CommonName: "CA", IsCA: true})
+	if err != nil {
+		return credsgen.Certificate{}, credsgen.Certificate{}, err
+	}
+	commonName := c.KindHost
+	if len(sans) > 0 {
+		commonName = sans[0]
+	}
+	cert, err := generator.GenerateCertificate("cert", credsgen.CertificateGenerationRequest{CommonName: commonName, CA: ca, AlternativeNames: sans})
+	if err != nil {
+		return credsgen.Certificate{}, credsgen.Certificate{}, err
+	}
+	return ca, cert, nil
+}
+
 // SimpleExtension it's returning a fake dummy Eirini extension
 func (c *Catalog) SimpleExtension() eirinix.Extension {
 
@@ -42,6 +67,35 @@ func (c *Catalog) SimpleExtension() eirinix.Extension {
 		parentExtension{Name: "test"}}
 }
 
+// SimpleExtensionWithOptions it's returning a fake dummy Eirini extension
+// which declares its own webhook options
+func (c *Catalog) SimpleExtensionWithOptions(o eirinix.AdmissionOptions) eirinix.Extension {
+	return &optionsExtension{
+		testExtension: testExtension{parentExtension{Name: "test"}},
+		options:       o,
+	}
+}
+
+// NamedExtension it's returning a fake dummy Eirini extension with a stable name
+func (c *Catalog) NamedExtension(name string) eirinix.Extension {
+	return &namedExtension{
+		testExtension: testExtension{parentExtension{Name: "test"}},
+		name:          name,
+	}
+}
+
+// DecodeErrorExtension it's returning a fake dummy Eirini extension
+// which denies the requests whose pod can't be decoded
+func (c *Catalog) DecodeErrorExtension() eirinix.Extension {
+	return &decodeErrorExtension{testExtension{parentExtension{Name: "test"}}}
+}
+
+// SimpleValidator it's returning a dummy Eirini validator
+// which denies pods running the "banned" image.
+func (c *Catalog) SimpleValidator() eirinix.Validator {
+	return &BannedImageValidator{Image: "banned"}
+}
+
 // SimpleReconciler it's returning a dummy Eirini reconciler extension
 // which adds the annotation "touched": "yes" to all created pods.
 func (c *Catalog) SimpleReconciler() eirinix.Reconciler {
@@ -288,3 +342,46 @@ func (sw *SimpleWatcherWithChannel) Handle(m eirinix.Manager, e watch.Event) {
 func (c *Catalog) SimpleWatcher() eirinix.Watcher {
 	return &SimpleWatch{}
 }
+
+type SelectiveWatch struct {
+	SimpleWatch
+	WatchSelector eirinix.WatchSelector
+}
+
+func (sw *SelectiveWatch) Selector() eirinix.WatchSelector {
+	return sw.WatchSelector
+}
+
+// SelectiveWatcher returns a dummy watcher of the objects matching the selector
+func (c *Catalog) SelectiveWatcher(selector eirinix.WatchSelector) *SelectiveWatch {
+	return &SelectiveWatch{WatchSelector: selector}
+}
+
+// PodEvent is a call of the callbacks of a PodEventHandler
+type PodEvent struct {
+	Type   watch.EventType
+	OldPod *corev1.Pod
+	Pod    *corev1.Pod
+}
+
+type SimplePodEventHandler struct {
+	SimpleWatcherWithChannel
+	Events chan PodEvent
+}
+
+func (h *SimplePodEventHandler) OnAdd(m eirinix.Manager, pod *corev1.Pod) {
+	h.Events <- PodEvent{Type: watch.Added, Pod: pod}
+}
+
+func (h *SimplePodEventHandler) OnUpdate(m eirinix.Manager, oldPod, newPod *corev1.Pod) {
+	h.Events <- PodEvent{Type: watch.Modified, OldPod: oldPod, Pod: newPod}
+}
+
+func (h *SimplePodEventHandler) OnDelete(m eirinix.Manager, pod *corev1.Pod) {
+	h.Events <- PodEvent{Type: watch.Deleted, Pod: pod}
+}
+
+// PodEventWatcher returns a dummy watcher receiving the typed callbacks of the pod informer
+func (c *Catalog) PodEventWatcher(events chan PodEvent) *SimplePodEventHandler {
+	return &SimplePodEventHandler{Events: events}
+}
@@ -0,0 +1,53 @@
+package testing
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	eirinix "code.cloudfoundry.org/eirinix"
+	"go.uber.org/zap"
+	"gomodules.xyz/jsonpatch/v2"
+	"k8s.io/api/admission/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// CheckExtensionsCompatible runs each extension against the pod, as separate webhooks would, and
+// returns an error listing the paths patched by more than one of them.
+func CheckExtensionsCompatible(pod *corev1.Pod, extensions ...eirinix.Extension) error {
+	raw, err := json.Marshal(pod)
+	if err != nil {
+		return err
+	}
+
+	m := eirinix.NewManager(eirinix.ManagerOptions{Logger: zap.NewNop().Sugar()})
+	req := admission.Request{AdmissionRequest: v1beta1.AdmissionRequest{
+		Operation: v1beta1.Create,
+		Object:    runtime.RawExtension{Raw: raw},
+	}}
+
+	patches := make([][]jsonpatch.JsonPatchOperation, len(extensions))
+	for i, e := range extensions {
+		res := e.Handle(context.Background(), m, pod.DeepCopy(), req)
+		if res.Result != nil && res.Result.Code >= 400 {
+			return fmt.Errorf("extension %d failed: %s", i, res.Result.Message)
+		}
+		patches[i], err = eirinix.ResponsePatches(res)
+		if err != nil {
+			return fmt.Errorf("extension %d returned an invalid patch: %s", i, err.Error())
+		}
+	}
+
+	conflicts := eirinix.FindPatchConflicts(patches)
+	if len(conflicts) == 0 {
+		return nil
+	}
+	descriptions := make([]string, len(conflicts))
+	for i, c := range conflicts {
+		descriptions[i] = c.String()
+	}
+	return fmt.Errorf("Conflicting patches: %s", strings.Join(descriptions, "; "))
+}
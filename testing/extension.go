@@ -2,11 +2,11 @@ package testing
 
 import (
 	"context"
-	"errors"
-	"net/http"
 
 	eirinix "code.cloudfoundry.org/eirinix"
 	"k8s.io/api/admission/v1beta1"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
 )
@@ -24,12 +24,35 @@ func (e *testExtension) Handle(context.Context, eirinix.Manager, *corev1.Pod, ad
 	return res
 }
 
+type optionsExtension struct {
+	testExtension
+	options eirinix.AdmissionOptions
+}
+
+func (e *optionsExtension) AdmissionOptions() eirinix.AdmissionOptions {
+	return e.options
+}
+
+type namedExtension struct {
+	testExtension
+	name string
+}
+
+func (e *namedExtension) Name() string {
+	return e.name
+}
+
+type decodeErrorExtension struct {
+	testExtension
+}
+
+func (e *decodeErrorExtension) HandleDecodeError(context.Context, eirinix.Manager, admission.Request, error) admission.Response {
+	return admission.Denied("undecodable pod")
+}
+
 type EditEnvExtension struct{}
 
 func (e *EditEnvExtension) Handle(ctx context.Context, eiriniManager eirinix.Manager, pod *corev1.Pod, req admission.Request) admission.Response {
-	if pod == nil {
-		return admission.Errored(http.StatusBadRequest, errors.New("No pod could be decoded from the request"))
-	}
 	podCopy := pod.DeepCopy()
 	for i := range podCopy.Spec.Containers {
 		c := &podCopy.Spec.Containers[i]
@@ -43,3 +66,56 @@ func (e *EditEnvExtension) Handle(ctx context.Context, eiriniManager eirinix.Man
 	}
 	return eiriniManager.PatchFromPod(req, podCopy)
 }
+
+// BannedImageValidator denies pods which run the banned image
+type BannedImageValidator struct {
+	Image string
+}
+
+func (v *BannedImageValidator) Validate(ctx context.Context, eiriniManager eirinix.Manager, pod *corev1.Pod, req admission.Request) eirinix.ValidationResult {
+	for _, c := range pod.Spec.Containers {
+		if c.Image == v.Image {
+			return eirinix.Deny("image " + v.Image + " is banned")
+		}
+	}
+	return eirinix.Allow()
+}
+
+// AnnotateStatefulSetExtension adds the "touched": "yes" annotation to StatefulSets
+type AnnotateStatefulSetExtension struct{}
+
+func (e *AnnotateStatefulSetExtension) Handle(ctx context.Context, eiriniManager eirinix.Manager, statefulSet *appsv1.StatefulSet, req admission.Request) admission.Response {
+	statefulSetCopy := statefulSet.DeepCopy()
+	if statefulSetCopy.Annotations == nil {
+		statefulSetCopy.Annotations = map[string]string{}
+	}
+	statefulSetCopy.Annotations["touched"] = "yes"
+	return eiriniManager.PatchFromObject(req, statefulSetCopy)
+}
+
+// AnnotateJobExtension adds the "touched": "yes" annotation to Jobs
+type AnnotateJobExtension struct{}
+
+func (e *AnnotateJobExtension) Handle(ctx context.Context, eiriniManager eirinix.Manager, job *batchv1.Job, req admission.Request) admission.Response {
+	jobCopy := job.DeepCopy()
+	if jobCopy.Annotations == nil {
+		jobCopy.Annotations = map[string]string{}
+	}
+	jobCopy.Annotations["touched"] = "yes"
+	return eiriniManager.PatchFromObject(req, jobCopy)
+}
+
+// AnnotatePodExtension sets the Key annotation of pods to Value
+type AnnotatePodExtension struct {
+	Key   string
+	Value string
+}
+
+func (e *AnnotatePodExtension) Handle(ctx context.Context, eiriniManager eirinix.Manager, pod *corev1.Pod, req admission.Request) admission.Response {
+	podCopy := pod.DeepCopy()
+	if podCopy.Annotations == nil {
+		podCopy.Annotations = map[string]string{}
+	}
+	podCopy.Annotations[e.Key] = e.Value
+	return eiriniManager.PatchFromPod(req, podCopy)
+}
@@ -82,6 +82,11 @@ func KubeClean() error {
 		return errors.Wrap(err, "Failed: "+string(str))
 	}
 
+	str, err = Kubectl([]string{}, "delete", "validatingwebhookconfiguration", "--all")
+	if err != nil {
+		return errors.Wrap(err, "Failed: "+string(str))
+	}
+
 	str, err = Kubectl([]string{}, "delete", "secrets", "--all")
 	if err != nil {
 		return errors.Wrap(err, "Failed: "+string(str))
@@ -0,0 +1,168 @@
+package extension
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/pkg/errors"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	machinerytypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"code.cloudfoundry.org/eirinix/util/ctxlog"
+)
+
+// UnregisterExtensions removes from the cluster what RegisterExtensions created for the OperatorFingerprint:
+// the webhooks of the mutating and validating webhook configurations, the setup certificate secret
+// and the operator namespace label.
+//
+// The webhooks of other operators are preserved, and the configurations are deleted only if they hold no other webhook.
+// Externally provided certificates are left untouched.
+func (m *DefaultExtensionManager) UnregisterExtensions() error {
+	if m.KubeManager == nil {
+		if err := m.generateManager(); err != nil {
+			return err
+		}
+	}
+	if m.Context == nil {
+		m.Context = ctxlog.NewManagerContext(m.Logger)
+	}
+	if m.WebhookConfig == nil {
+		m.GenWebHookServer()
+	}
+
+	if m.Options.RegisterWebHook == nil || *m.Options.RegisterWebHook {
+		version, err := m.AdmissionRegistrationVersion()
+		if err != nil {
+			return errors.Wrap(err, "detecting the admissionregistration api version")
+		}
+		m.WebhookConfig.AdmissionRegistrationVersion = version
+		if err := m.WebhookConfig.unregisterConfiguration(m.Context, "MutatingWebhookConfiguration", m.WebhookConfig.ConfigName); err != nil {
+			return err
+		}
+		if err := m.WebhookConfig.unregisterConfiguration(m.Context, "ValidatingWebhookConfiguration", m.WebhookConfig.ValidatingConfigName); err != nil {
+			return err
+		}
+	}
+
+	if m.Options.ExternalCertificate == nil && (m.Options.SetupCertificate == nil || *m.Options.SetupCertificate) {
+		if err := m.WebhookConfig.deleteCertificate(m.Context); err != nil {
+			return err
+		}
+	}
+
+	if m.Options.Namespace != "" {
+		if err := m.removeOperatorNamespaceLabel(); err != nil {
+			return errors.Wrap(err, "removing the operator namespace label")
+		}
+	}
+	return nil
+}
+
+// unregisterConfiguration removes the webhooks generated by the operator from the named configuration.
+// The configuration is deleted if no other webhook is left. Configurations which don't exist are skipped.
+// It retries on conflicts, e.g. when another operator edits a shared configuration at the same time.
+func (f *WebhookConfig) unregisterConfiguration(ctx context.Context, kind string, name string) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		config := &unstructured.Unstructured{}
+		config.SetGroupVersionKind(f.configurationGroupVersionKind(kind))
+		err := f.client.Get(ctx, machinerytypes.NamespacedName{Name: name}, config)
+		if k8serrors.IsNotFound(err) {
+			return nil
+		}
+		if err != nil {
+			return errors.Wrapf(err, "getting the %s %s", kind, name)
+		}
+
+		existing, _, err := unstructured.NestedSlice(config.Object, "webhooks")
+		if err != nil {
+			return errors.Wrapf(err, "reading the webhooks of the %s %s", kind, name)
+		}
+		webhooks := []interface{}{}
+		for _, w := range existing {
+			webhook, ok := w.(map[string]interface{})
+			if ok && f.ownWebhook(fmt.Sprint(webhook["name"]), nil) {
+				continue
+			}
+			webhooks = append(webhooks, w)
+		}
+
+		if len(webhooks) == 0 {
+			// The configuration is deleted only if no webhook was added since it was read
+			resourceVersion := config.GetResourceVersion()
+			err = f.client.Delete(ctx, config, client.Preconditions{ResourceVersion: &resourceVersion})
+			if err != nil && !k8serrors.IsNotFound(err) {
+				return errors.Wrapf(err, "deleting the %s %s", kind, name)
+			}
+			ctxlog.Infof(ctx, "Deleted the %s %s", kind, name)
+			return nil
+		}
+
+		if err := unstructured.SetNestedSlice(config.Object, webhooks, "webhooks"); err != nil {
+			return err
+		}
+		if err := f.client.Update(ctx, config); err != nil {
+			return errors.Wrapf(err, "removing the webhooks of the %s %s", kind, name)
+		}
+		ctxlog.Infof(ctx, "Removed the webhooks of the %s %s", kind, name)
+		return nil
+	})
+}
+
+// deleteCertificate deletes the secret holding the generated certificates
+func (f *WebhookConfig) deleteCertificate(ctx context.Context) error {
+	secret := &unstructured.Unstructured{}
+	secret.SetGroupVersionKind(schema.GroupVersionKind{
+		Group:   "",
+		Kind:    "Secret",
+		Version: "v1",
+	})
+	secret.SetName(f.setupCertificateName)
+	secret.SetNamespace(f.webhookNamespace)
+
+	err := f.client.Delete(ctx, secret)
+	if err != nil && !k8serrors.IsNotFound(err) {
+		return errors.Wrapf(err, "deleting the certificate secret %s", f.setupCertificateName)
+	}
+	return nil
+}
+
+func (m *DefaultExtensionManager) removeOperatorNamespaceLabel() error {
+	c := m.KubeManager.GetClient()
+	ns := &unstructured.Unstructured{}
+	ns.SetGroupVersionKind(schema.GroupVersionKind{
+		Group:   "",
+		Kind:    "Namespace",
+		Version: "v1",
+	})
+	ns.SetName(m.Options.Namespace)
+
+	err := c.Patch(m.Context, ns, removeLabelPatch{name: m.Options.getDefaultNamespaceLabel()})
+	if err != nil && !k8serrors.IsNotFound(err) {
+		return errors.Wrap(err, "updating the namespace object")
+	}
+	return nil
+}
+
+type removeLabelPatch struct {
+	name string
+}
+
+func (p removeLabelPatch) Type() machinerytypes.PatchType {
+	return machinerytypes.MergePatchType
+}
+
+func (p removeLabelPatch) Data(_ runtime.Object) ([]byte, error) {
+	return json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"labels": map[string]interface{}{
+				p.name: nil,
+			},
+		},
+	})
+}
@@ -0,0 +1,79 @@
+package extension
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// ValidationResult is the outcome of a Validator
+type ValidationResult struct {
+	// Allowed indicates whether or not the pod is admitted
+	Allowed bool
+
+	// Reason is the message returned to the user, typically explaining why the pod was denied
+	Reason string
+
+	// Warnings are returned to the user, also when the pod is admitted
+	Warnings []string
+}
+
+// Allow returns a ValidationResult which admits the pod
+func Allow(warnings ...string) ValidationResult {
+	return ValidationResult{Allowed: true, Warnings: warnings}
+}
+
+// Deny returns a ValidationResult which denies the pod with the given reason
+func Deny(reason string, warnings ...string) ValidationResult {
+	return ValidationResult{Allowed: false, Reason: reason, Warnings: warnings}
+}
+
+// DefaultValidatingWebhook is the implementation of the Webhook generated out of the Eirini Validator
+type DefaultValidatingWebhook struct {
+	admissionWebhook
+
+	// EiriniValidator is the Eirini validator associated with the webhook
+	EiriniValidator Validator
+}
+
+// NewValidatingWebhook returns a ValidatingWebhook out of an Eirini Validator
+func NewValidatingWebhook(v Validator, m Manager) ValidatingWebhook {
+	return &DefaultValidatingWebhook{
+		admissionWebhook: admissionWebhook{EiriniExtensionManager: m},
+		EiriniValidator:  v,
+	}
+}
+
+// RegisterAdmissionWebHook registers the Validating WebHook to the WebHook Server and returns the generated Admission Webhook
+func (w *DefaultValidatingWebhook) RegisterAdmissionWebHook(server *webhook.Server, opts WebhookOptions) error {
+	if err := w.setup(opts, w); err != nil {
+		return err
+	}
+
+	if server == nil {
+		return errors.New("The Validating webhook needs a Webhook server to register to")
+	}
+	server.Register(w.Path, w.Webhook)
+	return nil
+}
+
+// Handle delegates the validation to the Eirini Validator
+func (w *DefaultValidatingWebhook) Handle(ctx context.Context, req admission.Request) admission.Response {
+	pod, err := w.GetPod(req)
+	if err != nil {
+		return w.decodeFailed(ctx, req, w.EiriniValidator, err)
+	}
+	ctx, err = w.requestContext(ctx, req)
+	if err != nil {
+		return w.decodeFailed(ctx, req, w.EiriniValidator, err)
+	}
+
+	return w.run(ctx, req, w.ExtensionTimeout, func(ctx context.Context) admission.Response {
+		result := w.EiriniValidator.Validate(ctx, w.EiriniExtensionManager, pod, req)
+		res := admission.ValidationResponse(result.Allowed, result.Reason)
+		res.Warnings = result.Warnings
+		return res
+	})
+}
@@ -0,0 +1,94 @@
+package extension_test
+
+import (
+	"context"
+	"encoding/json"
+
+	. "code.cloudfoundry.org/eirinix"
+	catalog "code.cloudfoundry.org/eirinix/testing"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+var _ = Describe("Validating webhook implementation", func() {
+	var (
+		eirinixcatalog catalog.Catalog
+		eiriniManager  *DefaultExtensionManager
+		w              ValidatingWebhook
+		failurePolicy  admissionregistrationv1.FailurePolicyType
+	)
+
+	podRequest := func(image string) admission.Request {
+		pod := &corev1.Pod{Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "app", Image: image}}}}
+		raw, err := json.Marshal(pod)
+		Expect(err).ToNot(HaveOccurred())
+		return admission.Request{AdmissionRequest: admissionv1beta1.AdmissionRequest{Object: runtime.RawExtension{Raw: raw}}}
+	}
+
+	BeforeEach(func() {
+		eirinixcatalog = catalog.NewCatalog()
+		eiriniManager, _ = eirinixcatalog.SimpleManager().(*DefaultExtensionManager)
+		failurePolicy = admissionregistrationv1.Fail
+		w = NewValidatingWebhook(eirinixcatalog.SimpleValidator(), eiriniManager)
+
+		decoder, err := admission.NewDecoder(scheme.Scheme)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(w.InjectDecoder(decoder)).To(Succeed())
+	})
+
+	It("needs a webhook server", func() {
+		err := w.RegisterAdmissionWebHook(nil, WebhookOptions{ID: "validate-0", ManagerOptions: ManagerOptions{FailurePolicy: &failurePolicy, Namespace: "eirini", OperatorFingerprint: "eirini-x"}})
+		Expect(err).To(MatchError("The Validating webhook needs a Webhook server to register to"))
+	})
+
+	It("generates the webhook details", func() {
+		err := w.RegisterAdmissionWebHook(&webhook.Server{}, WebhookOptions{ID: "validate-0", ManagerOptions: ManagerOptions{FailurePolicy: &failurePolicy, Namespace: "eirini", OperatorFingerprint: "eirini-x"}})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(w.GetPath()).To(Equal("/validate-0"))
+		Expect(w.GetName()).To(Equal("validate-0.eirini-x.org"))
+		Expect(w.GetRules()[0].Rule.Resources).To(Equal([]string{"pods"}))
+		Expect(w.GetNamespaceSelector().MatchLabels).To(Equal(map[string]string{"eirini-x-ns": "eirini"}))
+	})
+
+	It("allows valid pods", func() {
+		res := w.Handle(context.Background(), podRequest("busybox"))
+		Expect(res.Allowed).To(BeTrue())
+	})
+
+	It("denies invalid pods with a reason", func() {
+		res := w.Handle(context.Background(), podRequest("banned"))
+		Expect(res.Allowed).To(BeFalse())
+		Expect(string(res.Result.Reason)).To(Equal("image banned is banned"))
+	})
+
+	It("returns the warnings", func() {
+		v := NewValidatingWebhook(validatorFunc(func() ValidationResult {
+			return Allow("deprecated field")
+		}), eiriniManager)
+		decoder, _ := admission.NewDecoder(scheme.Scheme)
+		v.InjectDecoder(decoder)
+
+		res := v.Handle(context.Background(), podRequest("busybox"))
+		Expect(res.Allowed).To(BeTrue())
+		Expect(res.Warnings).To(Equal([]string{"deprecated field"}))
+	})
+
+	It("rejects requests without a pod", func() {
+		res := w.Handle(context.Background(), admission.Request{})
+		Expect(res.Allowed).To(BeFalse())
+		Expect(res.Result.Code).To(Equal(int32(400)))
+	})
+})
+
+type validatorFunc func() ValidationResult
+
+func (f validatorFunc) Validate(context.Context, Manager, *corev1.Pod, admission.Request) ValidationResult {
+	return f()
+}
@@ -0,0 +1,222 @@
+package extension
+
+import (
+	"strconv"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+)
+
+// DefaultWatcherQueueSize is the number of events a watcher queue holds if no Size is given
+const DefaultWatcherQueueSize = 100
+
+// WatcherQueuePolicy defines what happens to the events of a watcher whose queue is full
+type WatcherQueuePolicy string
+
+const (
+	// WatcherQueuePolicyBlock waits for the watcher to make room in its queue, which holds back the watch
+	// and the other watchers. It is the default
+	WatcherQueuePolicyBlock WatcherQueuePolicy = "Block"
+	// WatcherQueuePolicyDropOldest drops the oldest event of the queue
+	WatcherQueuePolicyDropOldest WatcherQueuePolicy = "DropOldest"
+	// WatcherQueuePolicyCoalesce replaces the event of the same object in the queue, if there is one,
+	// and otherwise waits like WatcherQueuePolicyBlock
+	WatcherQueuePolicyCoalesce WatcherQueuePolicy = "Coalesce"
+)
+
+// WatcherQueueOptions configure the queues the watchers receive their events from
+type WatcherQueueOptions struct {
+	// Size is the number of events a queue holds. Optional, defaults to DefaultWatcherQueueSize
+	Size int
+
+	// Workers is the number of goroutines handling the events of a watcher. With more than one worker,
+	// the events are handled concurrently and in no particular order. Optional, defaults to 1
+	Workers int
+
+	// Policy is the policy for the events of a full queue. Optional, defaults to WatcherQueuePolicyBlock
+	Policy WatcherQueuePolicy
+}
+
+// QueuedWatcher is an optional interface a Watcher can implement to configure its own queue,
+// instead of using the WatcherQueue of the ManagerOptions
+type QueuedWatcher interface {
+	QueueOptions() WatcherQueueOptions
+}
+
+// watcherQueueOptions returns the options of the queue of the Watcher, or nil if it handles the events synchronously
+func (m *DefaultExtensionManager) watcherQueueOptions(w Watcher) *WatcherQueueOptions {
+	var options WatcherQueueOptions
+	if queued, ok := unwrapExtension(w).(QueuedWatcher); ok {
+		options = queued.QueueOptions()
+	} else if m.Options.WatcherQueue != nil {
+		options = *m.Options.WatcherQueue
+	} else {
+		return nil
+	}
+
+	if options.Size <= 0 {
+		options.Size = DefaultWatcherQueueSize
+	}
+	if options.Workers <= 0 {
+		options.Workers = 1
+	}
+	if options.Policy == "" {
+		options.Policy = WatcherQueuePolicyBlock
+	}
+	return &options
+}
+
+// watcherName returns the name of the Watcher in the metrics: its Name if it is Named, or its index
+func watcherName(i int, w Watcher) string {
+	if named, ok := unwrapExtension(w).(Named); ok {
+		return named.Name()
+	}
+	return strconv.Itoa(i)
+}
+
+// queuedEvent is an event in the queue of a Watcher, with its tracking in the checkpoint of the watch
+type queuedEvent struct {
+	event   watch.Event
+	tracked *trackedEvent
+}
+
+// watcherQueue is a bounded queue of the events of a Watcher, which its workers handle
+type watcherQueue struct {
+	name    string
+	options WatcherQueueOptions
+
+	events   []queuedEvent
+	closed   bool
+	mutex    sync.Mutex
+	notEmpty *sync.Cond
+	notFull  *sync.Cond
+}
+
+func newWatcherQueue(name string, options WatcherQueueOptions) *watcherQueue {
+	q := &watcherQueue{name: name, options: options}
+	q.notEmpty = sync.NewCond(&q.mutex)
+	q.notFull = sync.NewCond(&q.mutex)
+	return q
+}
+
+// push adds the event to the queue, according to the policy if the queue is full.
+// The events pushed after the queue is closed are dropped, and aren't marked as handled.
+func (q *watcherQueue) push(e queuedEvent) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	for !q.closed && len(q.events) >= q.options.Size {
+		if q.options.Policy == WatcherQueuePolicyDropOldest {
+			q.events[0].tracked.handled()
+			q.events = q.events[1:]
+			watcherQueueDropped.WithLabelValues(q.name).Inc()
+			break
+		}
+		if q.options.Policy == WatcherQueuePolicyCoalesce && q.coalesce(e) {
+			return
+		}
+		q.notFull.Wait()
+	}
+	if q.closed {
+		watcherQueueDropped.WithLabelValues(q.name).Inc()
+		return
+	}
+
+	q.events = append(q.events, e)
+	watcherQueueDepth.WithLabelValues(q.name).Set(float64(len(q.events)))
+	q.notEmpty.Signal()
+}
+
+// coalesce replaces the queued event of the object of e, and tells if there was one
+func (q *watcherQueue) coalesce(e queuedEvent) bool {
+	key, err := cache.MetaNamespaceKeyFunc(e.event.Object)
+	if err != nil {
+		return false
+	}
+	for i := range q.events {
+		if queued, err := cache.MetaNamespaceKeyFunc(q.events[i].event.Object); err == nil && queued == key {
+			q.events[i].tracked.handled()
+			q.events[i] = e
+			watcherQueueDropped.WithLabelValues(q.name).Inc()
+			return true
+		}
+	}
+	return false
+}
+
+// pop returns the oldest event of the queue, waiting for one if it's empty.
+// It returns false once the queue is closed and empty.
+func (q *watcherQueue) pop() (queuedEvent, bool) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	for !q.closed && len(q.events) == 0 {
+		q.notEmpty.Wait()
+	}
+	if len(q.events) == 0 {
+		return queuedEvent{}, false
+	}
+
+	e := q.events[0]
+	q.events = q.events[1:]
+	watcherQueueDepth.WithLabelValues(q.name).Set(float64(len(q.events)))
+	q.notFull.Signal()
+	return e, true
+}
+
+// close makes the workers stop once they handled the queued events
+func (q *watcherQueue) close() {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.closed = true
+	q.notEmpty.Broadcast()
+	q.notFull.Broadcast()
+}
+
+// startWatcherQueues starts the workers of the queued Watchers, which handle their events until stopWatcherQueues
+func (m *DefaultExtensionManager) startWatcherQueues() {
+	m.watcherQueues = make([]*watcherQueue, len(m.Watchers))
+	for i, w := range m.Watchers {
+		options := m.watcherQueueOptions(w)
+		if options == nil {
+			continue
+		}
+		q := newWatcherQueue(watcherName(i, w), *options)
+		m.watcherQueues[i] = q
+		for worker := 0; worker < options.Workers; worker++ {
+			go func(w Watcher) {
+				for {
+					e, ok := q.pop()
+					if !ok {
+						return
+					}
+					w.Handle(m, e.event)
+					e.tracked.handled()
+				}
+			}(w)
+		}
+	}
+}
+
+// closeWatcherQueues closes the queues of the Watchers, whose workers stop once they handled the queued events.
+// The events delivered afterwards are dropped, which unblocks the watches waiting on full queues.
+func (m *DefaultExtensionManager) closeWatcherQueues() {
+	for _, q := range m.watcherQueues {
+		if q != nil {
+			q.close()
+		}
+	}
+}
+
+// deliverEvent passes the event to the i-th Watcher, through its queue if it has one,
+// recording in the tracked event that the Watcher handles it
+func (m *DefaultExtensionManager) deliverEvent(i int, w Watcher, e watch.Event, t *trackedEvent) {
+	observeWatcherEvent(watcherName(i, w), e)
+	if i < len(m.watcherQueues) && m.watcherQueues[i] != nil {
+		t.handling()
+		m.watcherQueues[i].push(queuedEvent{event: e, tracked: t})
+		return
+	}
+	w.Handle(m, e)
+}
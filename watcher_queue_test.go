@@ -0,0 +1,201 @@
+package extension_test
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	. "code.cloudfoundry.org/eirinix"
+	catalog "code.cloudfoundry.org/eirinix/testing"
+	cfakes "code.cloudfoundry.org/eirinix/testing/fakes"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// slowWatcher is a queued watcher which handles the events once released
+type slowWatcher struct {
+	name    string
+	options WatcherQueueOptions
+	release chan struct{}
+
+	mutex   sync.Mutex
+	handled []watch.Event
+}
+
+func (w *slowWatcher) Name() string { return w.name }
+
+func (w *slowWatcher) QueueOptions() WatcherQueueOptions { return w.options }
+
+func (w *slowWatcher) Handle(_ Manager, e watch.Event) {
+	<-w.release
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.handled = append(w.handled, e)
+}
+
+// Handled returns the names of the pods of the handled events
+func (w *slowWatcher) Handled() []string {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	names := []string{}
+	for _, e := range w.handled {
+		names = append(names, e.Object.(*corev1.Pod).Name)
+	}
+	return names
+}
+
+// queueMetric returns the value of the metric of the queue of the watcher
+func queueMetric(family, watcher string) float64 {
+	families, err := metrics.Registry.Gather()
+	Expect(err).ToNot(HaveOccurred())
+	for _, f := range families {
+		if f.GetName() != family {
+			continue
+		}
+		for _, m := range f.GetMetric() {
+			if m.GetLabel()[0].GetValue() == watcher {
+				return m.GetCounter().GetValue() + m.GetGauge().GetValue()
+			}
+		}
+	}
+	return 0
+}
+
+// handledCount returns the number of events the watcher handled
+func (w *slowWatcher) handledCount() int {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return len(w.handled)
+}
+
+var _ = Describe("Watcher queues", func() {
+	var (
+		eirinixcatalog  catalog.Catalog
+		eiriniManager   *DefaultExtensionManager
+		podWatch        *watch.FakeWatcher
+		fast            chan watch.Event
+		stop            chan struct{}
+		done            chan error
+		resourceVersion int
+	)
+
+	BeforeEach(func() {
+		eirinixcatalog = catalog.NewCatalog()
+		eiriniManager = eirinixcatalog.SimpleManager().(*DefaultExtensionManager)
+		eiriniManager.Options.WatcherStartRV = "1"
+
+		podWatch = watch.NewFake()
+		fakeCorev1 := &cfakes.FakeCoreV1Interface{}
+		fakePod := &cfakes.FakePodInterface{}
+		fakePod.WatchCalls(func(context.Context, metav1.ListOptions) (watch.Interface, error) {
+			return podWatch, nil
+		})
+		fakeCorev1.PodsReturns(fakePod)
+		eiriniManager.SetKubeClient(fakeCorev1)
+
+		fast = make(chan watch.Event, 10)
+		stop = make(chan struct{})
+		done = make(chan error)
+		resourceVersion = 1
+	})
+
+	run := func() {
+		go func() {
+			done <- eiriniManager.RunWatchers(stop)
+		}()
+	}
+
+	// send sends the event of the pod through the watch, and waits for the synchronous fast watcher to handle it
+	send := func(eventType watch.EventType, name string) {
+		resourceVersion++
+		podWatch.Action(eventType, &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+			Name:            name,
+			Namespace:       "eirini",
+			ResourceVersion: strconv.Itoa(resourceVersion),
+		}})
+		Eventually(fast, 5*time.Second).Should(Receive())
+	}
+
+	// waitHandling waits for the worker of the watcher to take the queued event
+	waitHandling := func(watcher string) {
+		Eventually(func() float64 { return queueMetric("eirinix_watcher_queue_depth", watcher) }, 5*time.Second).Should(BeZero())
+	}
+
+	It("doesn't let a slow watcher hold back the others", func() {
+		slow := &slowWatcher{name: "slow", release: make(chan struct{})}
+		eiriniManager.Options.WatcherQueue = &WatcherQueueOptions{Size: 10}
+		eiriniManager.AddWatcher(slow)
+		eiriniManager.AddWatcher(eirinixcatalog.SimpleWatcherWithChannel(fast))
+		run()
+
+		send(watch.Added, "foo")
+		send(watch.Added, "bar")
+		Expect(slow.Handled()).To(BeEmpty())
+
+		close(slow.release)
+		Eventually(slow.Handled, 5*time.Second).Should(Equal([]string{"foo", "bar"}))
+		close(stop)
+		Eventually(done, 5*time.Second).Should(Receive(BeNil()))
+	})
+
+	It("drops the oldest events of a full queue", func() {
+		slow := &slowWatcher{name: "drop-oldest", release: make(chan struct{}), options: WatcherQueueOptions{Size: 1, Policy: WatcherQueuePolicyDropOldest}}
+		eiriniManager.AddWatcher(slow)
+		eiriniManager.AddWatcher(eirinixcatalog.SimpleWatcherWithChannel(fast))
+		dropped := queueMetric("eirinix_watcher_queue_dropped_total", "drop-oldest")
+		run()
+
+		send(watch.Added, "1")
+		// The first event is being handled, the others replace each other in the queue
+		waitHandling("drop-oldest")
+		send(watch.Added, "2")
+		send(watch.Added, "3")
+		send(watch.Added, "4")
+
+		close(slow.release)
+		Eventually(slow.Handled, 5*time.Second).Should(Equal([]string{"1", "4"}))
+		Expect(queueMetric("eirinix_watcher_queue_dropped_total", "drop-oldest")).To(Equal(dropped + 2.0))
+		close(stop)
+		Eventually(done, 5*time.Second).Should(Receive(BeNil()))
+	})
+
+	It("coalesces the events of the same object in a full queue", func() {
+		slow := &slowWatcher{name: "coalesce", release: make(chan struct{}), options: WatcherQueueOptions{Size: 1, Policy: WatcherQueuePolicyCoalesce}}
+		eiriniManager.AddWatcher(slow)
+		eiriniManager.AddWatcher(eirinixcatalog.SimpleWatcherWithChannel(fast))
+		dropped := queueMetric("eirinix_watcher_queue_dropped_total", "coalesce")
+		run()
+
+		send(watch.Added, "foo")
+		waitHandling("coalesce")
+		send(watch.Added, "bar")
+		send(watch.Modified, "bar")
+
+		close(slow.release)
+		Eventually(slow.Handled, 5*time.Second).Should(Equal([]string{"foo", "bar"}))
+		Expect(slow.handled[1].Type).To(Equal(watch.Modified))
+		Expect(queueMetric("eirinix_watcher_queue_dropped_total", "coalesce")).To(Equal(dropped + 1.0))
+		close(stop)
+		Eventually(done, 5*time.Second).Should(Receive(BeNil()))
+	})
+
+	It("stops while the watch waits on a full queue", func() {
+		slow := &slowWatcher{name: "block", release: make(chan struct{}), options: WatcherQueueOptions{Size: 1}}
+		defer close(slow.release)
+		eiriniManager.AddWatcher(slow)
+		run()
+
+		for _, name := range []string{"foo", "bar", "baz"} {
+			resourceVersion++
+			podWatch.Add(&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: name, ResourceVersion: strconv.Itoa(resourceVersion)}})
+		}
+
+		close(stop)
+		Eventually(done, 5*time.Second).Should(Receive(BeNil()))
+	})
+})
@@ -3,12 +3,21 @@ package extension
 import (
 	"context"
 	"fmt"
+	"net/http"
+	"runtime/debug"
+	"time"
 
 	"github.com/pkg/errors"
-	admissionregistrationv1beta1 "k8s.io/api/admissionregistration/v1beta1"
+	"go.uber.org/zap"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/scheme"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
@@ -16,107 +25,304 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
 )
 
+// DefaultWebhookTimeoutSeconds is the timeout of the generated webhooks, if not specified otherwise in the ManagerOptions
+const DefaultWebhookTimeoutSeconds int32 = 10
+
 type setReferenceFunc func(owner, object metav1.Object, scheme *runtime.Scheme) error
 
-// DefaultMutatingWebhook is the implementation of the Webhook generated out of the Eirini Extension
-type DefaultMutatingWebhook struct {
+// admissionWebhook contains the settings shared by the mutating and the validating webhooks
+type admissionWebhook struct {
 	decoder *admission.Decoder
 	client  client.Client
 
-	// EiriniExtension is the Eirini extension associated with the webhook
-	EiriniExtension Extension
-
 	// EiriniExtensionManager is the Manager which will be injected into the Handle.
 	EiriniExtensionManager Manager
 
 	// FilterEiriniApps indicates if the webhook will filter Eirini apps or not.
 	FilterEiriniApps bool
-	setReference     setReferenceFunc
+
+	// GroupVersionKind is the kind of the objects the webhook is called for
+	GroupVersionKind schema.GroupVersionKind
+
+	// DecodeErrorPolicy is the policy applied to the requests whose object can't be decoded
+	DecodeErrorPolicy DecodeErrorPolicy
 
 	// Name is the name of the webhook
 	Name string
 	// Path is the path this webhook will serve.
 	Path string
-	// Rules maps to the Rules field in admissionregistrationv1beta1.Webhook
-	Rules []admissionregistrationv1beta1.RuleWithOperations
-	// FailurePolicy maps to the FailurePolicy field in admissionregistrationv1beta1.Webhook
-	// This optional. If not set, will be defaulted to Ignore (fail-open) by the server.
-	// More details: https://github.com/kubernetes/api/blob/f5c295feaba2cbc946f0bbb8b535fc5f6a0345ee/admissionregistration/v1beta1/types.go#L144-L147
-	FailurePolicy admissionregistrationv1beta1.FailurePolicyType
-	// NamespaceSelector maps to the NamespaceSelector field in admissionregistrationv1beta1.Webhook
+	// Rules maps to the Rules field of the admissionregistrationv1 webhooks
+	Rules []admissionregistrationv1.RuleWithOperations
+	// FailurePolicy maps to the FailurePolicy field of the admissionregistrationv1 webhooks
+	FailurePolicy admissionregistrationv1.FailurePolicyType
+	// SideEffects maps to the SideEffects field of the admissionregistrationv1 webhooks
+	SideEffects admissionregistrationv1.SideEffectClass
+	// TimeoutSeconds maps to the TimeoutSeconds field of the admissionregistrationv1 webhooks
+	TimeoutSeconds int32
+	// ExtensionTimeout is the deadline of the Extension handling a request. No deadline is enforced if zero.
+	ExtensionTimeout time.Duration
+	// MatchPolicy maps to the MatchPolicy field of the admissionregistrationv1 webhooks
+	MatchPolicy admissionregistrationv1.MatchPolicyType
+	// NamespaceSelector maps to the NamespaceSelector field of the admissionregistrationv1 webhooks
 	// This optional.
 	NamespaceSelector *metav1.LabelSelector
-	// Handlers contains a list of handlers. Each handler may only contains the business logic for its own feature.
-	// For example, feature foo and bar can be in the same webhook if all the other configurations are the same.
-	// The handler will be invoked sequentially as the order in the list.
-	// Note: if you are using mutating webhook with multiple handlers, it's your responsibility to
-	// ensure the handlers are not generating conflicting JSON patches.
+	// ObjectSelector is the object selector requested by the Extension. It is merged with the
+	// Eirini apps filter in GetLabelSelector.
+	// This optional.
+	ObjectSelector *metav1.LabelSelector
+	// Handler contains the business logic of the webhook.
+	// Several Extensions can be served by the same webhook with an ExtensionChain, which detects
+	// the conflicting JSON patches according to the PatchConflictPolicy.
 	Handler admission.Handler
 	// Webhook contains the Admission webhook information that we register with the controller runtime.
 	Webhook *webhook.Admission
 }
 
-func (w *DefaultMutatingWebhook) GetName() string {
+// DefaultMutatingWebhook is the implementation of the Webhook generated out of the Eirini Extension
+type DefaultMutatingWebhook struct {
+	admissionWebhook
+
+	// EiriniExtension is the Eirini extension associated with the webhook
+	EiriniExtension Extension
+
+	// EiriniResourceExtension is the Eirini extension associated with the webhook, for resources other than pods.
+	// It is used in place of EiriniExtension if set.
+	EiriniResourceExtension ResourceExtension
+
+	setReference setReferenceFunc
+
+	// ReinvocationPolicy maps to the ReinvocationPolicy field in admissionregistrationv1.MutatingWebhook
+	ReinvocationPolicy admissionregistrationv1.ReinvocationPolicyType
+}
+
+func (w *admissionWebhook) GetName() string {
 	return w.Name
 }
 
-func (w *DefaultMutatingWebhook) GetRules() []admissionregistrationv1beta1.RuleWithOperations {
+func (w *admissionWebhook) GetRules() []admissionregistrationv1.RuleWithOperations {
 	return w.Rules
 }
 
-func (w *DefaultMutatingWebhook) GetFailurePolicy() admissionregistrationv1beta1.FailurePolicyType {
+func (w *admissionWebhook) GetFailurePolicy() admissionregistrationv1.FailurePolicyType {
 	return w.FailurePolicy
 }
 
-func (w *DefaultMutatingWebhook) GetNamespaceSelector() *metav1.LabelSelector {
+func (w *admissionWebhook) GetSideEffects() admissionregistrationv1.SideEffectClass {
+	return w.SideEffects
+}
+
+func (w *admissionWebhook) GetTimeoutSeconds() int32 {
+	return w.TimeoutSeconds
+}
+
+func (w *admissionWebhook) GetMatchPolicy() admissionregistrationv1.MatchPolicyType {
+	return w.MatchPolicy
+}
+
+func (w *DefaultMutatingWebhook) GetReinvocationPolicy() admissionregistrationv1.ReinvocationPolicyType {
+	return w.ReinvocationPolicy
+}
+
+func (w *admissionWebhook) GetNamespaceSelector() *metav1.LabelSelector {
 	return w.NamespaceSelector
 }
 
-func (w *DefaultMutatingWebhook) GetLabelSelector() *metav1.LabelSelector {
-	if w.FilterEiriniApps {
-		return &metav1.LabelSelector{
-			MatchLabels: map[string]string{LabelSourceType: "APP"},
-		}
+func (w *admissionWebhook) GetLabelSelector() *metav1.LabelSelector {
+	if !w.FilterEiriniApps {
+		return w.ObjectSelector
 	}
-	return nil
+
+	selector := &metav1.LabelSelector{}
+	if w.ObjectSelector != nil {
+		selector = w.ObjectSelector.DeepCopy()
+	}
+	if selector.MatchLabels == nil {
+		selector.MatchLabels = map[string]string{}
+	}
+	selector.MatchLabels[LabelSourceType] = "APP"
+	return selector
 }
 
-func (w *DefaultMutatingWebhook) GetHandler() admission.Handler {
+func (w *admissionWebhook) GetHandler() admission.Handler {
 	return w.Handler
 }
 
-func (w *DefaultMutatingWebhook) GetWebhook() *webhook.Admission {
+func (w *admissionWebhook) GetWebhook() *webhook.Admission {
 	return w.Webhook
 }
 
-func (w *DefaultMutatingWebhook) GetPath() string {
+func (w *admissionWebhook) GetPath() string {
 	return w.Path
 }
 
 // GetPod retrieves a pod from a types.Request
-func (w *DefaultMutatingWebhook) GetPod(req admission.Request) (*corev1.Pod, error) {
+func (w *admissionWebhook) GetPod(req admission.Request) (*corev1.Pod, error) {
 	pod := &corev1.Pod{}
+	if err := w.decode(req, pod); err != nil {
+		return nil, err
+	}
+	return pod, nil
+}
+
+// decode decodes the object of the request into obj.
+// DELETE requests carry only the old object, which is decoded instead.
+func (w *admissionWebhook) decode(req admission.Request, obj runtime.Object) error {
 	if w.decoder == nil {
-		return nil, errors.New("No decoder injected")
+		return errors.New("No decoder injected")
+	}
+	if req.Operation == admissionv1beta1.Delete {
+		return w.decoder.DecodeRaw(req.OldObject, obj)
 	}
-	err := w.decoder.Decode(req, pod)
-	return pod, err
+	return w.decoder.Decode(req, obj)
 }
 
+// decodeFailed returns the response to a request whose object couldn't be decoded.
+// The handler is the Extension of the webhook, which is delegated to if it implements DecodeErrorHandler.
+func (w *admissionWebhook) decodeFailed(ctx context.Context, req admission.Request, handler interface{}, err error) (res admission.Response) {
+	w.logger().Errorf("Failed decoding the %s of the admission request %s: %v", w.GroupVersionKind.Kind, req.UID, err)
+	defer func() { w.observeAdmission(req, res) }()
+
+	if h, ok := unwrapExtension(handler).(DecodeErrorHandler); ok {
+		return h.HandleDecodeError(ctx, w.EiriniExtensionManager, req, err)
+	}
+
+	switch w.DecodeErrorPolicy {
+	case DecodeErrorPolicyAllow:
+		return admission.Allowed("the object could not be decoded")
+	default:
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+}
+
+// run calls the Extension with the request context. Panics are recovered into an error response,
+// and the Extension is given the timeout to answer: past it, the request is allowed or
+// rejected according to the failure policy of the webhook.
+func (w *admissionWebhook) run(ctx context.Context, req admission.Request, timeout time.Duration, handle func(context.Context) admission.Response) (res admission.Response) {
+	start := time.Now()
+	defer func() {
+		w.observeAdmissionDuration(req, start)
+		w.observeAdmission(req, res)
+	}()
+
+	if timeout <= 0 {
+		return w.recoverHandle(ctx, req, handle)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	// Buffered, so that an Extension which answers after the deadline doesn't leak the goroutine forever
+	responses := make(chan admission.Response, 1)
+	go func() {
+		responses <- w.recoverHandle(ctx, req, handle)
+	}()
+
+	select {
+	case res := <-responses:
+		return res
+	case <-ctx.Done():
+		w.logger().Errorf("The %s extension didn't answer the admission request %s within %s", w.Name, req.UID, timeout)
+		if w.FailurePolicy == admissionregistrationv1.Ignore {
+			return admission.Allowed("the extension timed out")
+		}
+		return admission.Errored(http.StatusGatewayTimeout, fmt.Errorf("The %s extension timed out after %s", w.Name, timeout))
+	}
+}
+
+// recoverHandle calls the Extension and turns its panics into an error response
+func (w *admissionWebhook) recoverHandle(ctx context.Context, req admission.Request, handle func(context.Context) admission.Response) (res admission.Response) {
+	defer func() {
+		if r := recover(); r != nil {
+			w.logger().Errorf("The %s extension panicked handling the admission request %s: %v\n%s", w.Name, req.UID, r, debug.Stack())
+			res = admission.Errored(http.StatusInternalServerError, fmt.Errorf("The %s extension panicked: %v", w.Name, r))
+		}
+	}()
+	return handle(ctx)
+}
+
+func (w *admissionWebhook) logger() *zap.SugaredLogger {
+	if w.EiriniExtensionManager == nil || w.EiriniExtensionManager.GetLogger() == nil {
+		return zap.NewNop().Sugar()
+	}
+	return w.EiriniExtensionManager.GetLogger()
+}
+
+// DecodeErrorPolicy defines how the webhooks answer to requests whose object can't be decoded.
+// Extensions implementing DecodeErrorHandler handle those requests by themselves.
+type DecodeErrorPolicy string
+
+const (
+	// DecodeErrorPolicyReject rejects the request with a 400 (Bad Request) error. It is the default.
+	DecodeErrorPolicyReject DecodeErrorPolicy = "Reject"
+	// DecodeErrorPolicyAllow allows the request without changes
+	DecodeErrorPolicyAllow DecodeErrorPolicy = "Allow"
+)
+
 // WebhookOptions are the options required to register a WebHook to the WebHook server
 type WebhookOptions struct {
-	ID             string // Webhook path will be generated out of that
-	MatchLabels    map[string]string
-	Manager        manager.Manager
-	ManagerOptions ManagerOptions
+	ID               string // Webhook path will be generated out of that
+	MatchLabels      map[string]string
+	Manager          manager.Manager
+	ManagerOptions   ManagerOptions
+	AdmissionOptions AdmissionOptions
 }
 
+// AdmissionOptions are the webhook settings an Extension can declare by implementing
+// WebhookOptionsProvider. Unset fields fall back to the ManagerOptions and the library defaults.
+type AdmissionOptions struct {
+	// Operations are the operations the webhook is called for. Optional, defaults to CREATE and UPDATE
+	Operations []admissionregistrationv1.OperationType
+
+	// Resources are the resources the webhook is called for, in the group and version of the Extension kind.
+	// Optional, defaults to the resource of the Extension kind (pods for Extensions)
+	Resources []string
+
+	// FilterEiriniApps overrides the FilterEiriniApps of the ManagerOptions. For the ResourceExtensions, which
+	// don't use the one of the ManagerOptions, it restricts the webhook to the objects labelled as Eirini apps
+	FilterEiriniApps *bool
+
+	// FailurePolicy overrides the failure policy of the ManagerOptions
+	FailurePolicy *admissionregistrationv1.FailurePolicyType
+
+	// TimeoutSeconds overrides the WebhookTimeoutSeconds of the ManagerOptions
+	TimeoutSeconds *int32
+
+	// ExtensionTimeout overrides the ExtensionTimeout of the ManagerOptions
+	ExtensionTimeout *time.Duration
+
+	// ReinvocationPolicy is the reinvocation policy of the webhook. Optional, defaults to Never
+	ReinvocationPolicy *admissionregistrationv1.ReinvocationPolicyType
+
+	// ObjectSelector restricts the objects the webhook is called for. If the manager filters Eirini apps,
+	// the Eirini apps label is added to it.
+	ObjectSelector *metav1.LabelSelector
+
+	// NamespaceSelector overrides the namespace selector generated from the manager Namespace
+	NamespaceSelector *metav1.LabelSelector
+}
+
+// podGroupVersionKind is the kind of the objects handled by the Extensions and the Validators
+var podGroupVersionKind = corev1.SchemeGroupVersion.WithKind("Pod")
+
 // NewWebhook returns a MutatingWebhook out of an Eirini Extension
 func NewWebhook(e Extension, m Manager) MutatingWebhook {
-	return &DefaultMutatingWebhook{EiriniExtensionManager: m, EiriniExtension: e, setReference: controllerutil.SetControllerReference}
+	return &DefaultMutatingWebhook{
+		admissionWebhook: admissionWebhook{EiriniExtensionManager: m, GroupVersionKind: podGroupVersionKind},
+		EiriniExtension:  e,
+		setReference:     controllerutil.SetControllerReference,
+	}
 }
 
-func (w *DefaultMutatingWebhook) getNamespaceSelector(opts WebhookOptions) *metav1.LabelSelector {
+// NewResourceWebhook returns a MutatingWebhook out of an Eirini ResourceExtension
+func NewResourceWebhook(e ResourceExtension, m Manager) MutatingWebhook {
+	return &DefaultMutatingWebhook{
+		admissionWebhook:        admissionWebhook{EiriniExtensionManager: m, GroupVersionKind: e.GroupVersionKind()},
+		EiriniResourceExtension: e,
+		setReference:            controllerutil.SetControllerReference,
+	}
+}
+
+func (w *admissionWebhook) getNamespaceSelector(opts WebhookOptions) *metav1.LabelSelector {
 	if len(opts.MatchLabels) == 0 {
 		return &metav1.LabelSelector{
 			MatchLabels: map[string]string{
@@ -127,42 +333,104 @@ func (w *DefaultMutatingWebhook) getNamespaceSelector(opts WebhookOptions) *meta
 	return &metav1.LabelSelector{MatchLabels: opts.MatchLabels}
 }
 
-// RegisterAdmissionWebHook registers the Mutating WebHook to the WebHook Server and returns the generated Admission Webhook
-func (w *DefaultMutatingWebhook) RegisterAdmissionWebHook(server *webhook.Server, opts WebhookOptions) error {
-	if opts.ManagerOptions.FailurePolicy == nil {
+// setup fills the webhook settings from the WebhookOptions
+func (w *admissionWebhook) setup(opts WebhookOptions, handler admission.Handler) error {
+	if opts.ManagerOptions.FailurePolicy == nil && opts.AdmissionOptions.FailurePolicy == nil {
 		return errors.New("No failure policy set")
 	}
-	if opts.ManagerOptions.FilterEiriniApps != nil {
+	if w.GroupVersionKind.Empty() {
+		w.GroupVersionKind = podGroupVersionKind
+	}
+	// Only the pods of the Eirini apps are labelled with their source type, e.g. the staging Jobs aren't
+	// labelled as apps, so the other kinds are filtered only if their AdmissionOptions ask for it
+	switch {
+	case opts.AdmissionOptions.FilterEiriniApps != nil:
+		w.FilterEiriniApps = *opts.AdmissionOptions.FilterEiriniApps
+	case w.GroupVersionKind != podGroupVersionKind:
+		w.FilterEiriniApps = false
+	case opts.ManagerOptions.FilterEiriniApps != nil:
 		w.FilterEiriniApps = *opts.ManagerOptions.FilterEiriniApps
-	} else {
+	default:
 		w.FilterEiriniApps = true
 	}
 
-	globalScopeType := admissionregistrationv1beta1.ScopeType("*")
+	globalScopeType := admissionregistrationv1.ScopeType("*")
 
-	w.FailurePolicy = *opts.ManagerOptions.FailurePolicy
-	w.Rules = []admissionregistrationv1beta1.RuleWithOperations{
+	if opts.AdmissionOptions.FailurePolicy != nil {
+		w.FailurePolicy = *opts.AdmissionOptions.FailurePolicy
+	} else {
+		w.FailurePolicy = *opts.ManagerOptions.FailurePolicy
+	}
+	w.SideEffects = admissionregistrationv1.SideEffectClassNone
+	if opts.ManagerOptions.SideEffects != nil {
+		w.SideEffects = *opts.ManagerOptions.SideEffects
+	}
+	w.TimeoutSeconds = DefaultWebhookTimeoutSeconds
+	if opts.ManagerOptions.WebhookTimeoutSeconds != nil {
+		w.TimeoutSeconds = *opts.ManagerOptions.WebhookTimeoutSeconds
+	}
+	if opts.AdmissionOptions.TimeoutSeconds != nil {
+		w.TimeoutSeconds = *opts.AdmissionOptions.TimeoutSeconds
+	}
+	w.ExtensionTimeout = opts.ManagerOptions.ExtensionTimeout
+	if opts.AdmissionOptions.ExtensionTimeout != nil {
+		w.ExtensionTimeout = *opts.AdmissionOptions.ExtensionTimeout
+	}
+	w.MatchPolicy = admissionregistrationv1.Equivalent
+	if opts.ManagerOptions.MatchPolicy != nil {
+		w.MatchPolicy = *opts.ManagerOptions.MatchPolicy
+	}
+	operations := opts.AdmissionOptions.Operations
+	if len(operations) == 0 {
+		operations = []admissionregistrationv1.OperationType{
+			"CREATE",
+			"UPDATE",
+		}
+	}
+	resources := opts.AdmissionOptions.Resources
+	if len(resources) == 0 {
+		plural, _ := meta.UnsafeGuessKindToResource(w.GroupVersionKind)
+		resources = []string{plural.Resource}
+	}
+	w.Rules = []admissionregistrationv1.RuleWithOperations{
 		{
-			Rule: admissionregistrationv1beta1.Rule{
-				APIGroups:   []string{""},
-				APIVersions: []string{"v1"},
-				Resources:   []string{"pods"},
+			Rule: admissionregistrationv1.Rule{
+				APIGroups:   []string{w.GroupVersionKind.Group},
+				APIVersions: []string{w.GroupVersionKind.Version},
+				Resources:   resources,
 				Scope:       &globalScopeType,
 			},
-			Operations: []admissionregistrationv1beta1.OperationType{
-				"CREATE",
-				"UPDATE",
-			},
+			Operations: operations,
 		},
 	}
 	w.Path = fmt.Sprintf("/%s", opts.ID)
 
 	w.Name = fmt.Sprintf("%s.%s.org", opts.ID, opts.ManagerOptions.OperatorFingerprint)
-	if opts.ManagerOptions.Namespace != "" {
+	if opts.AdmissionOptions.NamespaceSelector != nil {
+		w.NamespaceSelector = opts.AdmissionOptions.NamespaceSelector
+	} else if opts.ManagerOptions.Namespace != "" {
 		w.NamespaceSelector = w.getNamespaceSelector(opts)
 	}
+	w.ObjectSelector = opts.AdmissionOptions.ObjectSelector
+	w.DecodeErrorPolicy = DecodeErrorPolicyReject
+	if opts.ManagerOptions.DecodeErrorPolicy != "" {
+		w.DecodeErrorPolicy = opts.ManagerOptions.DecodeErrorPolicy
+	}
 	w.Webhook = &admission.Webhook{
-		Handler: w,
+		Handler: handler,
+	}
+	return nil
+}
+
+// RegisterAdmissionWebHook registers the Mutating WebHook to the WebHook Server and returns the generated Admission Webhook
+func (w *DefaultMutatingWebhook) RegisterAdmissionWebHook(server *webhook.Server, opts WebhookOptions) error {
+	if err := w.setup(opts, w); err != nil {
+		return err
+	}
+
+	w.ReinvocationPolicy = admissionregistrationv1.NeverReinvocationPolicy
+	if opts.AdmissionOptions.ReinvocationPolicy != nil {
+		w.ReinvocationPolicy = *opts.AdmissionOptions.ReinvocationPolicy
 	}
 
 	if server == nil {
@@ -173,19 +441,102 @@ func (w *DefaultMutatingWebhook) RegisterAdmissionWebHook(server *webhook.Server
 }
 
 // InjectClient injects the client.
-func (w *DefaultMutatingWebhook) InjectClient(c client.Client) error {
+func (w *admissionWebhook) InjectClient(c client.Client) error {
 	w.client = c
 	return nil
 }
 
 // InjectDecoder injects the decoder.
-func (w *DefaultMutatingWebhook) InjectDecoder(d *admission.Decoder) error {
+func (w *admissionWebhook) InjectDecoder(d *admission.Decoder) error {
 	w.decoder = d
 	return nil
 }
 
+// GetObject retrieves an object of the webhook GroupVersionKind from a types.Request.
+// Kinds which are not known to the kubernetes scheme are decoded as unstructured objects.
+func (w *admissionWebhook) GetObject(req admission.Request) (runtime.Object, error) {
+	if w.decoder == nil {
+		return nil, errors.New("No decoder injected")
+	}
+
+	obj := w.newObject()
+	if err := w.decode(req, obj); err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
+
+// GetOldObject retrieves the object before the change from an UPDATE request.
+// It returns nil for the other operations.
+func (w *admissionWebhook) GetOldObject(req admission.Request) (runtime.Object, error) {
+	if req.Operation != admissionv1beta1.Update || len(req.OldObject.Raw) == 0 {
+		return nil, nil
+	}
+	if w.decoder == nil {
+		return nil, errors.New("No decoder injected")
+	}
+
+	obj := w.newObject()
+	if err := w.decoder.DecodeRaw(req.OldObject, obj); err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
+
+// newObject returns an empty object of the webhook kind: a typed one for the kinds known to the
+// client-go scheme, an unstructured one otherwise
+func (w *admissionWebhook) newObject() runtime.Object {
+	obj, err := scheme.Scheme.New(w.GroupVersionKind)
+	if err != nil {
+		u := &unstructured.Unstructured{}
+		u.SetGroupVersionKind(w.GroupVersionKind)
+		return u
+	}
+	return obj
+}
+
+// requestContext returns the context passed to the Extensions, carrying the old object of UPDATE requests
+func (w *admissionWebhook) requestContext(ctx context.Context, req admission.Request) (context.Context, error) {
+	old, err := w.GetOldObject(req)
+	if err != nil {
+		return ctx, errors.Wrap(err, "decoding the old object")
+	}
+	if old == nil {
+		return ctx, nil
+	}
+	return withOldObject(ctx, old), nil
+}
+
 // Handle delegates the Handle function to the Eirini Extension
 func (w *DefaultMutatingWebhook) Handle(ctx context.Context, req admission.Request) admission.Response {
-	pod, _ := w.GetPod(req)
-	return w.EiriniExtension.Handle(ctx, w.EiriniExtensionManager, pod, req)
+	if w.EiriniResourceExtension != nil {
+		obj, err := w.GetObject(req)
+		if err != nil {
+			return w.decodeFailed(ctx, req, w.EiriniResourceExtension, err)
+		}
+		ctx, err = w.requestContext(ctx, req)
+		if err != nil {
+			return w.decodeFailed(ctx, req, w.EiriniResourceExtension, err)
+		}
+		return w.run(ctx, req, w.ExtensionTimeout, func(ctx context.Context) admission.Response {
+			return w.EiriniResourceExtension.Handle(ctx, w.EiriniExtensionManager, obj, req)
+		})
+	}
+
+	pod, err := w.GetPod(req)
+	if err != nil {
+		return w.decodeFailed(ctx, req, w.EiriniExtension, err)
+	}
+	ctx, err = w.requestContext(ctx, req)
+	if err != nil {
+		return w.decodeFailed(ctx, req, w.EiriniExtension, err)
+	}
+	// The extensions of a chain are each given their own ExtensionTimeout, see ExtensionChain.Handle
+	timeout := w.ExtensionTimeout
+	if _, chained := w.EiriniExtension.(*ExtensionChain); chained {
+		timeout = 0
+	}
+	return w.run(ctx, req, timeout, func(ctx context.Context) admission.Response {
+		return w.EiriniExtension.Handle(ctx, w.EiriniExtensionManager, pod, req)
+	})
 }
@@ -3,36 +3,67 @@ package extension
 import (
 	"context"
 	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"net"
 	"net/url"
 	"os"
 	"path"
 	"strconv"
+	"strings"
+	"time"
 
 	"code.cloudfoundry.org/quarks-utils/pkg/credsgen"
 	"github.com/pkg/errors"
 	"github.com/spf13/afero"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
 	admissionregistrationv1beta1 "k8s.io/api/admissionregistration/v1beta1"
 	corev1 "k8s.io/api/core/v1"
 	k8serrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	machinerytypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	"code.cloudfoundry.org/eirinix/util/ctxlog"
 )
 
+// admissionReviewVersions are the AdmissionReview versions understood by the webhook server
+var admissionReviewVersions = []string{"v1beta1"}
+
 // WebhookConfig generates certificates and the configuration for the webhook server
 type WebhookConfig struct {
-	ConfigName    string
-	CertDir       string
-	Certificate   []byte
-	Key           []byte
-	CaCertificate []byte
-	CaKey         []byte
+	ConfigName string
+	// ValidatingConfigName is the name of the ValidatingWebhookConfiguration generated from the Validators
+	ValidatingConfigName string
+	CertDir              string
+	Certificate          []byte
+	Key                  []byte
+	CaCertificate        []byte
+	CaKey                []byte
+
+	// AdmissionRegistrationVersion is the admissionregistration.k8s.io version used to register the webhooks.
+	// Defaults to v1 if empty.
+	AdmissionRegistrationVersion string
+
+	// OperatorFingerprint identifies the webhooks generated by the operator, which are replaced on registration.
+	// The other webhooks of the configurations are preserved.
+	OperatorFingerprint string
+
+	// ExtraSANs are SubjectAltNames added to the generated certificate, besides the webhook server addresses
+	ExtraSANs []string
+
+	// RenewBefore is the time before the expiry of the certificates when they are regenerated.
+	// Defaults to DefaultCertificateRenewBefore if zero.
+	RenewBefore time.Duration
+
+	// previousCaCertificate is the CA replaced by the last renewal. It stays in the CA bundle of the
+	// webhooks, so that the API server trusts the webhook server while it reloads the new certificate.
+	// It is saved in the Secret along with the certificates, so that every replica publishes the same bundle.
+	previousCaCertificate []byte
 
 	serviceName, webhookNamespace string
 	setupCertificateName          string
@@ -59,6 +90,34 @@ func NewWebhookConfig(c client.Client, config *Config, generator credsgen.Genera
 // SetupCertificate ensures that a CA and a certificate is available for the
 // webhook server
 func (f *WebhookConfig) setupCertificate(ctx context.Context) error {
+	if err := f.ensureCertificate(ctx); err != nil {
+		return err
+	}
+	f.observeCertificateExpiry()
+
+	err := f.writeSecretFiles()
+	if err != nil {
+		return errors.Wrap(err, "writing webhook certificate files to disk")
+	}
+
+	return nil
+}
+
+// ensureCertificate loads the certificates from the Secret, and generates them if the Secret
+// doesn't exist yet or if they expire within RenewBefore. When another replica writes the Secret
+// concurrently, the certificates it saved are loaded instead.
+func (f *WebhookConfig) ensureCertificate(ctx context.Context) error {
+	retriable := func(err error) bool {
+		return k8serrors.IsConflict(err) || k8serrors.IsAlreadyExists(err)
+	}
+	return retry.OnError(retry.DefaultRetry, retriable, func() error {
+		return f.loadOrGenerateCertificate(ctx)
+	})
+}
+
+// loadOrGenerateCertificate loads the certificates from the Secret, or generates them and saves them in the Secret.
+// The certificates are kept only once they are saved.
+func (f *WebhookConfig) loadOrGenerateCertificate(ctx context.Context) error {
 	secretNamespacedName := machinerytypes.NamespacedName{
 		Name:      f.setupCertificateName,
 		Namespace: f.webhookNamespace,
@@ -77,136 +136,254 @@ func (f *WebhookConfig) setupCertificate(ctx context.Context) error {
 		return err
 	}
 
-	if secret.GetName() != "" {
-		ctxlog.Info(ctx, "Not creating the webhook server certificate because it already exists")
-		data := secret.Object["data"].(map[string]interface{})
-		caKey, err := base64.StdEncoding.DecodeString(data["ca_private_key"].(string))
+	if secret.GetName() == "" {
+		ctxlog.Info(ctx, "Creating webhook server certificate")
+		certificates, err := f.generateCertificate()
 		if err != nil {
 			return err
 		}
-		caCert, err := base64.StdEncoding.DecodeString(data["ca_certificate"].(string))
-		if err != nil {
-			return err
+
+		newSecret := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      secretNamespacedName.Name,
+				Namespace: secretNamespacedName.Namespace,
+			},
+			Data: certificates.secretData(),
 		}
-		key, err := base64.StdEncoding.DecodeString(data["private_key"].(string))
-		if err != nil {
+		if err := f.client.Create(ctx, newSecret); err != nil {
 			return err
 		}
-		cert, err := base64.StdEncoding.DecodeString(data["certificate"].(string))
+		f.setCertificates(certificates)
+		return nil
+	}
+
+	data, _ := secret.Object["data"].(map[string]interface{})
+	caKey, err := decodeSecretField(data, "ca_private_key")
+	if err != nil {
+		return err
+	}
+	caCert, err := decodeSecretField(data, "ca_certificate")
+	if err != nil {
+		return err
+	}
+	key, err := decodeSecretField(data, "private_key")
+	if err != nil {
+		return err
+	}
+	cert, err := decodeSecretField(data, "certificate")
+	if err != nil {
+		return err
+	}
+	// Secrets written before any renewal have no previous CA
+	var previousCaCert []byte
+	if _, ok := data["previous_ca_certificate"]; ok {
+		previousCaCert, err = decodeSecretField(data, "previous_ca_certificate")
 		if err != nil {
 			return err
 		}
+	}
 
-		f.CaKey = caKey
-		f.CaCertificate = caCert
-		f.Key = key
-		f.Certificate = cert
-	} else {
-		ctxlog.Info(ctx, "Creating webhook server certificate")
+	f.setCertificates(&webhookCertificates{
+		caKey:                 caKey,
+		caCertificate:         caCert,
+		key:                   key,
+		certificate:           cert,
+		previousCaCertificate: previousCaCert,
+	})
 
-		// Generate CA
-		caRequest := credsgen.CertificateGenerationRequest{
-			CommonName:       "SCF CA",
-			IsCA:             true,
-			AlternativeNames: []string{f.config.WebhookServerHost},
-		}
+	err = f.checkCertificate(time.Now())
+	if err == nil {
+		ctxlog.Info(ctx, "Not creating the webhook server certificate because it already exists")
+		return nil
+	}
+	ctxlog.Infof(ctx, "Renewing the webhook server certificate: %v", err)
 
-		caCert, err := f.generator.GenerateCertificate("webhook-server-ca", caRequest)
-		if err != nil {
-			return err
-		}
+	certificates, err := f.generateCertificate()
+	if err != nil {
+		return err
+	}
+	certificates.previousCaCertificate = caCert
+	encoded := map[string]interface{}{}
+	for k, v := range certificates.secretData() {
+		encoded[k] = base64.StdEncoding.EncodeToString(v)
+	}
+	secret.Object["data"] = encoded
+	if err := f.client.Update(ctx, secret); err != nil {
+		return err
+	}
+	f.setCertificates(certificates)
+	return nil
+}
 
-		commonName := f.config.WebhookServerHost
-		if len(f.serviceName) > 0 {
-			if len(f.webhookNamespace) == 0 {
-				return errors.New("No webhook namespace defined. If you run the extension under a service, you need to specify the service namespace")
-			}
-			commonName = fmt.Sprintf("%s.%s.svc", f.serviceName, f.webhookNamespace)
-		}
+// webhookCertificates are a CA and a certificate signed by it, along with the CA they replaced if any
+type webhookCertificates struct {
+	caKey                 []byte
+	caCertificate         []byte
+	key                   []byte
+	certificate           []byte
+	previousCaCertificate []byte
+}
 
-		// Generate Certificate
-		request := credsgen.CertificateGenerationRequest{
-			IsCA:       false,
-			CommonName: commonName,
-			CA: credsgen.Certificate{
-				IsCA:        true,
-				PrivateKey:  caCert.PrivateKey,
-				Certificate: caCert.Certificate,
-			},
-		}
-		cert, err := f.generator.GenerateCertificate("webhook-server-cert", request)
-		if err != nil {
-			return err
-		}
+func (c *webhookCertificates) secretData() map[string][]byte {
+	data := map[string][]byte{
+		"certificate":    c.certificate,
+		"private_key":    c.key,
+		"ca_certificate": c.caCertificate,
+		"ca_private_key": c.caKey,
+	}
+	if len(c.previousCaCertificate) > 0 {
+		data["previous_ca_certificate"] = c.previousCaCertificate
+	}
+	return data
+}
 
-		newSecret := &corev1.Secret{
-			ObjectMeta: metav1.ObjectMeta{
-				Name:      secretNamespacedName.Name,
-				Namespace: secretNamespacedName.Namespace,
-			},
-			Data: map[string][]byte{
-				"certificate":    cert.Certificate,
-				"private_key":    cert.PrivateKey,
-				"ca_certificate": caCert.Certificate,
-				"ca_private_key": caCert.PrivateKey,
-			},
+// setCertificates makes the certificates the ones served and published by the WebhookConfig
+func (f *WebhookConfig) setCertificates(c *webhookCertificates) {
+	f.CaKey = c.caKey
+	f.CaCertificate = c.caCertificate
+	f.Key = c.key
+	f.Certificate = c.certificate
+	f.previousCaCertificate = c.previousCaCertificate
+}
+
+// generateCertificate generates a new CA and a new certificate signed by it
+func (f *WebhookConfig) generateCertificate() (*webhookCertificates, error) {
+	// Generate CA
+	caRequest := credsgen.CertificateGenerationRequest{
+		CommonName:       "SCF CA",
+		IsCA:             true,
+		AlternativeNames: []string{f.config.WebhookServerHost},
+	}
+
+	caCert, err := f.generator.GenerateCertificate("webhook-server-ca", caRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(f.serviceName) > 0 && len(f.webhookNamespace) == 0 {
+		return nil, errors.New("No webhook namespace defined. If you run the extension under a service, you need to specify the service namespace")
+	}
+
+	// Generate Certificate
+	request := credsgen.CertificateGenerationRequest{
+		IsCA:             false,
+		CommonName:       f.commonName(),
+		AlternativeNames: f.subjectAltNames(),
+		CA: credsgen.Certificate{
+			IsCA:        true,
+			PrivateKey:  caCert.PrivateKey,
+			Certificate: caCert.Certificate,
+		},
+	}
+	cert, err := f.generator.GenerateCertificate("webhook-server-cert", request)
+	if err != nil {
+		return nil, err
+	}
+
+	return &webhookCertificates{
+		caKey:         caCert.PrivateKey,
+		caCertificate: caCert.Certificate,
+		key:           cert.PrivateKey,
+		certificate:   cert.Certificate,
+	}, nil
+}
+
+// commonName returns the CommonName of the certificate: the service DNS name if the webhooks are registered
+// with a service, the host otherwise
+func (f *WebhookConfig) commonName() string {
+	if len(f.serviceName) > 0 {
+		return fmt.Sprintf("%s.%s.svc", f.serviceName, f.webhookNamespace)
+	}
+	return f.config.WebhookServerHost
+}
+
+// subjectAltNames returns the DNS names and IPs the webhook server is reached at: the service DNS
+// names if the webhooks are registered with a service, the host otherwise, and the ExtraSANs.
+func (f *WebhookConfig) subjectAltNames() []string {
+	var names []string
+	if len(f.serviceName) > 0 {
+		names = append(names,
+			f.serviceName,
+			fmt.Sprintf("%s.%s", f.serviceName, f.webhookNamespace),
+			fmt.Sprintf("%s.%s.svc", f.serviceName, f.webhookNamespace),
+			fmt.Sprintf("%s.%s.svc.cluster.local", f.serviceName, f.webhookNamespace),
+		)
+	} else if len(f.config.WebhookServerHost) > 0 {
+		names = append(names, f.config.WebhookServerHost)
+	}
+	names = append(names, f.ExtraSANs...)
+
+	seen := map[string]bool{}
+	sans := []string{}
+	for _, name := range names {
+		// IPs are compared in their canonical form, as parsed from the certificates
+		if ip := net.ParseIP(name); ip != nil {
+			name = ip.String()
 		}
-		err = f.client.Create(ctx, newSecret)
-		if err != nil {
-			return err
+		if !seen[name] {
+			seen[name] = true
+			sans = append(sans, name)
 		}
+	}
+	return sans
+}
 
-		f.CaKey = caCert.PrivateKey
-		f.CaCertificate = caCert.Certificate
-		f.Key = cert.PrivateKey
-		f.Certificate = cert.Certificate
+func decodeSecretField(data map[string]interface{}, field string) ([]byte, error) {
+	value, ok := data[field].(string)
+	if !ok {
+		return nil, fmt.Errorf("The webhook certificate secret has no %s", field)
 	}
+	return base64.StdEncoding.DecodeString(value)
+}
 
-	err = f.writeSecretFiles()
-	if err != nil {
-		return errors.Wrap(err, "writing webhook certificate files to disk")
+func (f *WebhookConfig) clientConfig(path string) admissionregistrationv1.WebhookClientConfig {
+	if f.serviceName != "" {
+		return admissionregistrationv1.WebhookClientConfig{
+			CABundle: f.caBundle(),
+			Service: &admissionregistrationv1.ServiceReference{
+				Name:      f.serviceName,
+				Namespace: f.webhookNamespace,
+				Path:      &path,
+				Port:      &f.config.WebhookServerPort,
+			},
+		}
 	}
 
-	return nil
+	url := url.URL{
+		Scheme: "https",
+		Host:   net.JoinHostPort(f.config.WebhookServerHost, strconv.Itoa(int(f.config.WebhookServerPort))),
+		Path:   path,
+	}
+	urlString := url.String()
+	return admissionregistrationv1.WebhookClientConfig{
+		CABundle: f.caBundle(),
+		URL:      &urlString,
+	}
 }
 
-func (f *WebhookConfig) GenerateAdmissionWebhook(webhooks []MutatingWebhook) []admissionregistrationv1beta1.MutatingWebhook {
+// GenerateAdmissionWebhook returns the admissionregistration.k8s.io/v1 webhooks for the given MutatingWebhooks
+func (f *WebhookConfig) GenerateAdmissionWebhook(webhooks []MutatingWebhook) []admissionregistrationv1.MutatingWebhook {
 
-	var mutatingHooks []admissionregistrationv1beta1.MutatingWebhook
+	var mutatingHooks []admissionregistrationv1.MutatingWebhook
 
 	for _, webhook := range webhooks {
-		var clientConfig admissionregistrationv1beta1.WebhookClientConfig
-		if f.serviceName != "" {
-			p := webhook.GetPath()
-			clientConfig = admissionregistrationv1beta1.WebhookClientConfig{
-				CABundle: f.CaCertificate,
-				Service: &admissionregistrationv1beta1.ServiceReference{
-					Name:      f.serviceName,
-					Namespace: f.webhookNamespace,
-					Path:      &p,
-					Port:      &f.config.WebhookServerPort,
-				},
-			}
-		} else {
-			url := url.URL{
-				Scheme: "https",
-				Host:   net.JoinHostPort(f.config.WebhookServerHost, strconv.Itoa(int(f.config.WebhookServerPort))),
-				Path:   webhook.GetPath(),
-			}
-			urlString := url.String()
-			clientConfig = admissionregistrationv1beta1.WebhookClientConfig{
-				CABundle: f.CaCertificate,
-				URL:      &urlString,
-			}
-		}
 		p := webhook.GetFailurePolicy()
-		wh := admissionregistrationv1beta1.MutatingWebhook{
-			Name:              webhook.GetName(),
-			Rules:             webhook.GetRules(),
-			FailurePolicy:     &p,
-			NamespaceSelector: webhook.GetNamespaceSelector(),
-			ClientConfig:      clientConfig,
-			ObjectSelector:    webhook.GetLabelSelector(),
+		sideEffects := webhook.GetSideEffects()
+		timeoutSeconds := webhook.GetTimeoutSeconds()
+		matchPolicy := webhook.GetMatchPolicy()
+		reinvocationPolicy := webhook.GetReinvocationPolicy()
+		wh := admissionregistrationv1.MutatingWebhook{
+			Name:                    webhook.GetName(),
+			Rules:                   webhook.GetRules(),
+			FailurePolicy:           &p,
+			NamespaceSelector:       webhook.GetNamespaceSelector(),
+			ClientConfig:            f.clientConfig(webhook.GetPath()),
+			ObjectSelector:          webhook.GetLabelSelector(),
+			SideEffects:             &sideEffects,
+			TimeoutSeconds:          &timeoutSeconds,
+			MatchPolicy:             &matchPolicy,
+			ReinvocationPolicy:      &reinvocationPolicy,
+			AdmissionReviewVersions: admissionReviewVersions,
 		}
 
 		mutatingHooks = append(mutatingHooks, wh)
@@ -214,21 +391,125 @@ func (f *WebhookConfig) GenerateAdmissionWebhook(webhooks []MutatingWebhook) []a
 	return mutatingHooks
 }
 
+// GenerateValidatingAdmissionWebhook returns the admissionregistration.k8s.io/v1 webhooks for the given ValidatingWebhooks
+func (f *WebhookConfig) GenerateValidatingAdmissionWebhook(webhooks []ValidatingWebhook) []admissionregistrationv1.ValidatingWebhook {
+
+	var validatingHooks []admissionregistrationv1.ValidatingWebhook
+
+	for _, webhook := range webhooks {
+		p := webhook.GetFailurePolicy()
+		sideEffects := webhook.GetSideEffects()
+		timeoutSeconds := webhook.GetTimeoutSeconds()
+		matchPolicy := webhook.GetMatchPolicy()
+		wh := admissionregistrationv1.ValidatingWebhook{
+			Name:                    webhook.GetName(),
+			Rules:                   webhook.GetRules(),
+			FailurePolicy:           &p,
+			NamespaceSelector:       webhook.GetNamespaceSelector(),
+			ClientConfig:            f.clientConfig(webhook.GetPath()),
+			ObjectSelector:          webhook.GetLabelSelector(),
+			SideEffects:             &sideEffects,
+			TimeoutSeconds:          &timeoutSeconds,
+			MatchPolicy:             &matchPolicy,
+			AdmissionReviewVersions: admissionReviewVersions,
+		}
+
+		validatingHooks = append(validatingHooks, wh)
+	}
+	return validatingHooks
+}
+
+// GenerateAdmissionWebhookV1beta1 returns the admissionregistration.k8s.io/v1beta1 webhooks for the given MutatingWebhooks.
+// It is used only on clusters which don't serve admissionregistration.k8s.io/v1.
+func (f *WebhookConfig) GenerateAdmissionWebhookV1beta1(webhooks []MutatingWebhook) ([]admissionregistrationv1beta1.MutatingWebhook, error) {
+	var mutatingHooks []admissionregistrationv1beta1.MutatingWebhook
+	if err := convertWebhooks(f.GenerateAdmissionWebhook(webhooks), &mutatingHooks); err != nil {
+		return nil, err
+	}
+	return mutatingHooks, nil
+}
+
+// GenerateValidatingAdmissionWebhookV1beta1 returns the admissionregistration.k8s.io/v1beta1 webhooks for the given ValidatingWebhooks.
+// It is used only on clusters which don't serve admissionregistration.k8s.io/v1.
+func (f *WebhookConfig) GenerateValidatingAdmissionWebhookV1beta1(webhooks []ValidatingWebhook) ([]admissionregistrationv1beta1.ValidatingWebhook, error) {
+	var validatingHooks []admissionregistrationv1beta1.ValidatingWebhook
+	if err := convertWebhooks(f.GenerateValidatingAdmissionWebhook(webhooks), &validatingHooks); err != nil {
+		return nil, err
+	}
+	return validatingHooks, nil
+}
+
+// convertWebhooks converts v1 webhooks to v1beta1 ones.
+// The v1beta1 webhooks share the serialization of the v1 ones, with less strict defaults.
+func convertWebhooks(in, out interface{}) error {
+	data, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, out)
+}
+
+func (f *WebhookConfig) generateMutatingWebhookConfiguration(webhooks []MutatingWebhook) (runtime.Object, error) {
+	objectMeta := metav1.ObjectMeta{
+		Name:      f.ConfigName,
+		Namespace: f.config.Namespace,
+	}
+
+	switch f.AdmissionRegistrationVersion {
+	case "", admissionregistrationv1.SchemeGroupVersion.Version:
+		return &admissionregistrationv1.MutatingWebhookConfiguration{
+			ObjectMeta: objectMeta,
+			Webhooks:   f.GenerateAdmissionWebhook(webhooks),
+		}, nil
+	case admissionregistrationv1beta1.SchemeGroupVersion.Version:
+		hooks, err := f.GenerateAdmissionWebhookV1beta1(webhooks)
+		if err != nil {
+			return nil, err
+		}
+		return &admissionregistrationv1beta1.MutatingWebhookConfiguration{
+			ObjectMeta: objectMeta,
+			Webhooks:   hooks,
+		}, nil
+	}
+	return nil, fmt.Errorf("Unsupported admissionregistration version %s", f.AdmissionRegistrationVersion)
+}
+
+func (f *WebhookConfig) generateValidatingWebhookConfiguration(webhooks []ValidatingWebhook) (runtime.Object, error) {
+	objectMeta := metav1.ObjectMeta{
+		Name:      f.ValidatingConfigName,
+		Namespace: f.config.Namespace,
+	}
+
+	switch f.AdmissionRegistrationVersion {
+	case "", admissionregistrationv1.SchemeGroupVersion.Version:
+		return &admissionregistrationv1.ValidatingWebhookConfiguration{
+			ObjectMeta: objectMeta,
+			Webhooks:   f.GenerateValidatingAdmissionWebhook(webhooks),
+		}, nil
+	case admissionregistrationv1beta1.SchemeGroupVersion.Version:
+		hooks, err := f.GenerateValidatingAdmissionWebhookV1beta1(webhooks)
+		if err != nil {
+			return nil, err
+		}
+		return &admissionregistrationv1beta1.ValidatingWebhookConfiguration{
+			ObjectMeta: objectMeta,
+			Webhooks:   hooks,
+		}, nil
+	}
+	return nil, fmt.Errorf("Unsupported admissionregistration version %s", f.AdmissionRegistrationVersion)
+}
+
 func (f *WebhookConfig) registerWebhooks(ctx context.Context, webhooks []MutatingWebhook) error {
 	if len(f.CaCertificate) == 0 {
 		return errors.New("Can not create a webhook server config with an empty ca certificate")
 	}
 
-	config := &admissionregistrationv1beta1.MutatingWebhookConfiguration{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      f.ConfigName,
-			Namespace: f.config.Namespace,
-		},
-		Webhooks: f.GenerateAdmissionWebhook(webhooks),
+	config, err := f.generateMutatingWebhookConfiguration(webhooks)
+	if err != nil {
+		return errors.Wrap(err, "generating the webhook configuration")
 	}
 
-	f.client.Delete(ctx, config)
-	err := f.client.Create(ctx, config)
+	err = f.applyConfiguration(ctx, "MutatingWebhookConfiguration", f.ConfigName, config)
 	if err != nil {
 		return errors.Wrap(err, "generating the webhook configuration")
 	}
@@ -236,23 +517,124 @@ func (f *WebhookConfig) registerWebhooks(ctx context.Context, webhooks []Mutatin
 	return nil
 }
 
-func (f *WebhookConfig) writeSecretFiles() error {
-	if exists, _ := afero.DirExists(f.config.Fs, f.CertDir); !exists {
-		err := f.config.Fs.Mkdir(f.CertDir, 0700)
+// registerValidatingWebhooks applies the validating webhook configuration. Without Validators, the webhooks
+// of the operator are removed from it instead, as they would point to paths which aren't served anymore.
+func (f *WebhookConfig) registerValidatingWebhooks(ctx context.Context, webhooks []ValidatingWebhook) error {
+	if len(webhooks) == 0 {
+		return f.unregisterConfiguration(ctx, "ValidatingWebhookConfiguration", f.ValidatingConfigName)
+	}
+	if len(f.CaCertificate) == 0 {
+		return errors.New("Can not create a validating webhook server config with an empty ca certificate")
+	}
+
+	config, err := f.generateValidatingWebhookConfiguration(webhooks)
+	if err != nil {
+		return errors.Wrap(err, "generating the validating webhook configuration")
+	}
+
+	err = f.applyConfiguration(ctx, "ValidatingWebhookConfiguration", f.ValidatingConfigName, config)
+	if err != nil {
+		return errors.Wrap(err, "generating the validating webhook configuration")
+	}
+
+	return nil
+}
+
+// applyConfiguration creates the webhook configuration, or updates it in place if it exists already.
+// The webhooks of the existing configuration which weren't generated by this operator are preserved.
+// Conflicting writes, e.g. by another replica starting at the same time, are retried.
+func (f *WebhookConfig) applyConfiguration(ctx context.Context, kind string, name string, config runtime.Object) error {
+	desired, err := runtime.DefaultUnstructuredConverter.ToUnstructured(config)
+	if err != nil {
+		return err
+	}
+	desiredWebhooks, _, err := unstructured.NestedSlice(desired, "webhooks")
+	if err != nil {
+		return err
+	}
+	generated := map[string]bool{}
+	for _, w := range desiredWebhooks {
+		if webhook, ok := w.(map[string]interface{}); ok {
+			generated[fmt.Sprint(webhook["name"])] = true
+		}
+	}
+
+	retriable := func(err error) bool {
+		return k8serrors.IsConflict(err) || k8serrors.IsAlreadyExists(err)
+	}
+	return retry.OnError(retry.DefaultRetry, retriable, func() error {
+		existing := &unstructured.Unstructured{}
+		existing.SetGroupVersionKind(f.configurationGroupVersionKind(kind))
+		err := f.client.Get(ctx, machinerytypes.NamespacedName{Name: name}, existing)
+		if k8serrors.IsNotFound(err) {
+			return f.client.Create(ctx, config.DeepCopyObject())
+		}
+		if err != nil {
+			return err
+		}
+
+		webhooks := runtime.DeepCopyJSONValue(desiredWebhooks).([]interface{})
+		existingWebhooks, _, err := unstructured.NestedSlice(existing.Object, "webhooks")
 		if err != nil {
 			return err
 		}
+		for _, w := range existingWebhooks {
+			webhook, ok := w.(map[string]interface{})
+			if !ok || f.ownWebhook(fmt.Sprint(webhook["name"]), generated) {
+				continue
+			}
+			webhooks = append(webhooks, webhook)
+		}
+		if err := unstructured.SetNestedSlice(existing.Object, webhooks, "webhooks"); err != nil {
+			return err
+		}
+		return f.client.Update(ctx, existing)
+	})
+}
+
+// ownWebhook returns true if the webhook was generated by this operator, now or by a previous version of the extensions
+func (f *WebhookConfig) ownWebhook(name string, generated map[string]bool) bool {
+	if generated[name] {
+		return true
 	}
+	return f.OperatorFingerprint != "" && strings.HasSuffix(name, fmt.Sprintf(".%s.org", f.OperatorFingerprint))
+}
 
-	err := afero.WriteFile(f.config.Fs, path.Join(f.CertDir, "ca-key.pem"), f.CaKey, 0600)
-	if err != nil {
+// configurationGroupVersionKind returns the kind of the webhook configurations in the admissionregistration version in use
+func (f *WebhookConfig) configurationGroupVersionKind(kind string) schema.GroupVersionKind {
+	version := f.AdmissionRegistrationVersion
+	if version == "" {
+		version = "v1"
+	}
+	return schema.GroupVersionKind{
+		Group:   "admissionregistration.k8s.io",
+		Kind:    kind,
+		Version: version,
+	}
+}
+
+func (f *WebhookConfig) writeSecretFiles() error {
+	if err := f.writeTLSFiles(); err != nil {
 		return err
 	}
-	err = afero.WriteFile(f.config.Fs, path.Join(f.CertDir, "ca-cert.pem"), f.CaCertificate, 0644)
+
+	err := afero.WriteFile(f.config.Fs, path.Join(f.CertDir, "ca-key.pem"), f.CaKey, 0600)
 	if err != nil {
 		return err
 	}
-	err = afero.WriteFile(f.config.Fs, path.Join(f.CertDir, "tls.key"), f.Key, 0600)
+	return afero.WriteFile(f.config.Fs, path.Join(f.CertDir, "ca-cert.pem"), f.CaCertificate, 0644)
+}
+
+// writeTLSFiles writes the certificate served by the webhook server to CertDir
+func (f *WebhookConfig) writeTLSFiles() error {
+	if exists, _ := afero.DirExists(f.config.Fs, f.CertDir); !exists {
+		err := f.config.Fs.Mkdir(f.CertDir, 0700)
+		if err != nil {
+			return err
+		}
+	}
+
+	err := afero.WriteFile(f.config.Fs, path.Join(f.CertDir, "tls.key"), f.Key, 0600)
 	if err != nil {
 		return err
 	}
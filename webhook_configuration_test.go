@@ -11,6 +11,7 @@ import (
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	. "github.com/onsi/gomega/gstruct"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
 	admissionregistrationv1beta1 "k8s.io/api/admissionregistration/v1beta1"
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -29,7 +30,7 @@ var _ = Describe("Webhook configuration implementation", func() {
 		ServiceManager, Manager             Manager
 		eiriniServiceManager, eiriniManager *DefaultExtensionManager
 	)
-	failurePolicy := admissionregistrationv1beta1.Fail
+	failurePolicy := admissionregistrationv1.Fail
 
 	BeforeEach(func() {
 		eirinixcatalog = catalog.NewCatalog()
@@ -104,6 +105,62 @@ var _ = Describe("Webhook configuration implementation", func() {
 		})
 	})
 
+	Context("with the admissionregistration v1 fields", func() {
+		It("sets the defaults on the generated webhooks", func() {
+			w := NewWebhook(eirinixcatalog.SimpleExtension(), eiriniManager)
+			err := w.RegisterAdmissionWebHook(eiriniManager.WebhookServer, WebhookOptions{ID: "volume", ManagerOptions: ManagerOptions{
+				FailurePolicy:       &failurePolicy,
+				Namespace:           "eirini",
+				OperatorFingerprint: "eirini-x"}})
+			Expect(err).ToNot(HaveOccurred())
+			admissions := eiriniManager.WebhookConfig.GenerateAdmissionWebhook([]MutatingWebhook{w})
+
+			Expect(admissions).To(HaveLen(1))
+			Expect(*admissions[0].SideEffects).To(Equal(admissionregistrationv1.SideEffectClassNone))
+			Expect(*admissions[0].TimeoutSeconds).To(Equal(DefaultWebhookTimeoutSeconds))
+			Expect(*admissions[0].MatchPolicy).To(Equal(admissionregistrationv1.Equivalent))
+			Expect(admissions[0].AdmissionReviewVersions).To(Equal([]string{"v1beta1"}))
+		})
+
+		It("takes the values from the manager options", func() {
+			sideEffects := admissionregistrationv1.SideEffectClassNoneOnDryRun
+			timeout := int32(5)
+			matchPolicy := admissionregistrationv1.Exact
+			w := NewWebhook(eirinixcatalog.SimpleExtension(), eiriniManager)
+			err := w.RegisterAdmissionWebHook(eiriniManager.WebhookServer, WebhookOptions{ID: "volume", ManagerOptions: ManagerOptions{
+				FailurePolicy:         &failurePolicy,
+				SideEffects:           &sideEffects,
+				WebhookTimeoutSeconds: &timeout,
+				MatchPolicy:           &matchPolicy,
+				Namespace:             "eirini",
+				OperatorFingerprint:   "eirini-x"}})
+			Expect(err).ToNot(HaveOccurred())
+			admissions := eiriniManager.WebhookConfig.GenerateAdmissionWebhook([]MutatingWebhook{w})
+
+			Expect(admissions).To(HaveLen(1))
+			Expect(*admissions[0].SideEffects).To(Equal(sideEffects))
+			Expect(*admissions[0].TimeoutSeconds).To(Equal(timeout))
+			Expect(*admissions[0].MatchPolicy).To(Equal(matchPolicy))
+		})
+
+		It("converts the webhooks to v1beta1", func() {
+			w := NewWebhook(eirinixcatalog.SimpleExtension(), eiriniManager)
+			err := w.RegisterAdmissionWebHook(eiriniManager.WebhookServer, WebhookOptions{ID: "volume", ManagerOptions: ManagerOptions{
+				FailurePolicy:       &failurePolicy,
+				Namespace:           "eirini",
+				OperatorFingerprint: "eirini-x"}})
+			Expect(err).ToNot(HaveOccurred())
+			admissions, err := eiriniManager.WebhookConfig.GenerateAdmissionWebhookV1beta1([]MutatingWebhook{w})
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(admissions).To(HaveLen(1))
+			Expect(admissions[0].Name).To(Equal("volume.eirini-x.org"))
+			Expect(*admissions[0].FailurePolicy).To(Equal(admissionregistrationv1beta1.Fail))
+			Expect(*admissions[0].SideEffects).To(Equal(admissionregistrationv1beta1.SideEffectClassNone))
+			Expect(admissions[0].Rules[0].Resources).To(Equal([]string{"pods"}))
+		})
+	})
+
 	Context("with eirini filtering turned on", func() {
 		It("adds an ObjectSelector to the webhook config", func() {
 			w := NewWebhook(eirinixcatalog.SimpleExtension(), eiriniServiceManager)
@@ -2,6 +2,8 @@ package extension_test
 
 import (
 	"context"
+	"encoding/json"
+	"time"
 
 	credsgen "code.cloudfoundry.org/quarks-utils/pkg/credsgen"
 	gfakes "code.cloudfoundry.org/quarks-utils/pkg/credsgen/fakes"
@@ -10,8 +12,12 @@ import (
 	cfakes "code.cloudfoundry.org/eirinix/testing/fakes"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
-	admissionregistrationv1beta1 "k8s.io/api/admissionregistration/v1beta1"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/client-go/kubernetes/scheme"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
@@ -28,8 +34,21 @@ var _ = Describe("Webhook implementation", func() {
 		ServiceManager, Manager             Manager
 		eiriniServiceManager, eiriniManager *DefaultExtensionManager
 		w                                   MutatingWebhook
+		decoder                             *admission.Decoder
 	)
 
+	podRequest := func(op admissionv1beta1.Operation) admission.Request {
+		raw, err := json.Marshal(&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "foo"}})
+		Expect(err).ToNot(HaveOccurred())
+		req := admission.Request{AdmissionRequest: admissionv1beta1.AdmissionRequest{Operation: op}}
+		if op == admissionv1beta1.Delete {
+			req.OldObject = runtime.RawExtension{Raw: raw}
+		} else {
+			req.Object = runtime.RawExtension{Raw: raw}
+		}
+		return req
+	}
+
 	BeforeEach(func() {
 		eirinixcatalog = catalog.NewCatalog()
 		ServiceManager = eirinixcatalog.SimpleManagerService()
@@ -65,6 +84,10 @@ var _ = Describe("Webhook implementation", func() {
 		eiriniServiceManager.Credsgen = generator
 		w = NewWebhook(eirinixcatalog.SimpleExtension(), eiriniManager)
 
+		var err error
+		decoder, err = admission.NewDecoder(scheme.Scheme)
+		Expect(err).ToNot(HaveOccurred())
+
 	})
 
 	Context("With a fake extension", func() {
@@ -72,7 +95,7 @@ var _ = Describe("Webhook implementation", func() {
 		It("It errors without a manager", func() {
 			err := w.RegisterAdmissionWebHook(nil, WebhookOptions{ID: "volume", ManagerOptions: ManagerOptions{Namespace: "eirini", OperatorFingerprint: "eirini-x"}})
 			Expect(err.Error()).To(Equal("No failure policy set"))
-			failurePolicy := admissionregistrationv1beta1.Fail
+			failurePolicy := admissionregistrationv1.Fail
 
 			err = w.RegisterAdmissionWebHook(nil, WebhookOptions{ID: "volume", ManagerOptions: ManagerOptions{FailurePolicy: &failurePolicy, Namespace: "eirini", OperatorFingerprint: "eirini-x"}})
 			Expect(err.Error()).To(Equal("The Mutating webhook needs a Webhook server to register to"))
@@ -80,8 +103,8 @@ var _ = Describe("Webhook implementation", func() {
 
 		It("Delegates to the Extension the handler", func() {
 			ctx := context.Background()
-			t := admission.Request{}
-			res := w.Handle(ctx, t)
+			Expect(w.InjectDecoder(decoder)).To(Succeed())
+			res := w.Handle(ctx, podRequest(admissionv1beta1.Create))
 			annotations := res.AdmissionResponse.AuditAnnotations
 			v, ok := annotations["name"]
 			Expect(ok).To(Equal(true))
@@ -92,7 +115,7 @@ var _ = Describe("Webhook implementation", func() {
 
 			err := w.RegisterAdmissionWebHook(nil, WebhookOptions{ID: "volume", ManagerOptions: ManagerOptions{Namespace: "eirini", OperatorFingerprint: "eirini-x"}})
 			Expect(err.Error()).To(Equal("No failure policy set"))
-			failurePolicy := admissionregistrationv1beta1.Fail
+			failurePolicy := admissionregistrationv1.Fail
 
 			err = w.RegisterAdmissionWebHook(nil, WebhookOptions{ID: "volume", ManagerOptions: ManagerOptions{FailurePolicy: &failurePolicy, Namespace: "eirini", OperatorFingerprint: "eirini-x"}})
 			Expect(err.Error()).To(Equal("The Mutating webhook needs a Webhook server to register to"))
@@ -114,13 +137,211 @@ var _ = Describe("Webhook implementation", func() {
 			Expect(mutatingWebHook.Rules[0].Rule.APIVersions).To(Equal([]string{"v1"}))
 			Expect(mutatingWebHook.Rules[0].Rule.Resources).To(Equal([]string{"pods"}))
 			Expect(mutatingWebHook.Rules[0].Operations).To(Equal(
-				[]admissionregistrationv1beta1.OperationType{
+				[]admissionregistrationv1.OperationType{
 					"CREATE",
 					"UPDATE",
 				}))
-			Expect(*mutatingWebHook.Rules[0].Rule.Scope).To(Equal(admissionregistrationv1beta1.ScopeType("*")))
+			Expect(*mutatingWebHook.Rules[0].Rule.Scope).To(Equal(admissionregistrationv1.ScopeType("*")))
+			Expect(mutatingWebHook.ReinvocationPolicy).To(Equal(admissionregistrationv1.NeverReinvocationPolicy))
+
+		})
+
+		It("It uses the Extension admission options over the manager options", func() {
+			failurePolicy := admissionregistrationv1.Fail
+			ignore := admissionregistrationv1.Ignore
+			timeout := int32(3)
+			reinvocation := admissionregistrationv1.IfNeededReinvocationPolicy
+			w = NewWebhook(eirinixcatalog.SimpleExtension(), eiriniManager)
+
+			err := w.RegisterAdmissionWebHook(eiriniManager.WebhookServer, WebhookOptions{ID: "volume",
+				ManagerOptions: ManagerOptions{
+					FailurePolicy:       &failurePolicy,
+					Namespace:           "eirini",
+					OperatorFingerprint: "eirini-x"},
+				AdmissionOptions: AdmissionOptions{
+					Operations:         []admissionregistrationv1.OperationType{admissionregistrationv1.Create},
+					Resources:          []string{"pods", "pods/binding"},
+					FailurePolicy:      &ignore,
+					TimeoutSeconds:     &timeout,
+					ReinvocationPolicy: &reinvocation,
+					ObjectSelector:     &metav1.LabelSelector{MatchLabels: map[string]string{"foo": "bar"}},
+					NamespaceSelector:  &metav1.LabelSelector{MatchLabels: map[string]string{"ns": "selected"}},
+				}})
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(w.GetFailurePolicy()).To(Equal(ignore))
+			Expect(w.GetTimeoutSeconds()).To(Equal(timeout))
+			Expect(w.GetReinvocationPolicy()).To(Equal(reinvocation))
+			Expect(w.GetRules()[0].Operations).To(Equal([]admissionregistrationv1.OperationType{admissionregistrationv1.Create}))
+			Expect(w.GetRules()[0].Rule.Resources).To(Equal([]string{"pods", "pods/binding"}))
+			Expect(w.GetNamespaceSelector().MatchLabels).To(Equal(map[string]string{"ns": "selected"}))
+			Expect(w.GetLabelSelector().MatchLabels).To(Equal(map[string]string{"foo": "bar", LabelSourceType: "APP"}))
+		})
+
+	})
+
+	Context("When the pod can't be decoded", func() {
+		failurePolicy := admissionregistrationv1.Fail
+
+		register := func(w MutatingWebhook, policy DecodeErrorPolicy) {
+			err := w.RegisterAdmissionWebHook(eiriniManager.WebhookServer, WebhookOptions{ID: "volume", ManagerOptions: ManagerOptions{
+				FailurePolicy:       &failurePolicy,
+				DecodeErrorPolicy:   policy,
+				Namespace:           "eirini",
+				OperatorFingerprint: "eirini-x"}})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(w.InjectDecoder(decoder)).To(Succeed())
+		}
+
+		It("rejects the request by default", func() {
+			register(w, "")
+			res := w.Handle(context.Background(), admission.Request{})
+			Expect(res.Allowed).To(BeFalse())
+			Expect(res.Result.Code).To(Equal(int32(400)))
+		})
+
+		It("rejects the request without a decoder", func() {
+			res := w.Handle(context.Background(), podRequest(admissionv1beta1.Create))
+			Expect(res.Allowed).To(BeFalse())
+			Expect(res.Result.Code).To(Equal(int32(400)))
+			Expect(res.Result.Message).To(Equal("No decoder injected"))
+		})
+
+		It("allows the request with the Allow policy", func() {
+			register(w, DecodeErrorPolicyAllow)
+			res := w.Handle(context.Background(), admission.Request{})
+			Expect(res.Allowed).To(BeTrue())
+			Expect(res.Patches).To(BeEmpty())
+			Expect(res.AdmissionResponse.AuditAnnotations).To(BeEmpty())
+		})
 
+		It("delegates to the Extension if it handles decode errors", func() {
+			w = NewWebhook(eirinixcatalog.DecodeErrorExtension(), eiriniManager)
+			register(w, DecodeErrorPolicyAllow)
+			res := w.Handle(context.Background(), admission.Request{})
+			Expect(res.Allowed).To(BeFalse())
+			Expect(string(res.Result.Reason)).To(Equal("undecodable pod"))
 		})
 
+		It("decodes the old pod of DELETE requests", func() {
+			register(w, "")
+			res := w.Handle(context.Background(), podRequest(admissionv1beta1.Delete))
+			Expect(res.AdmissionResponse.AuditAnnotations).To(HaveKeyWithValue("name", "test"))
+		})
+	})
+
+	Context("When the request is an UPDATE", func() {
+		var (
+			oldPod *corev1.Pod
+			found  bool
+		)
+
+		BeforeEach(func() {
+			oldPod, found = nil, false
+			w = NewWebhook(extensionFunc(func(ctx context.Context, pod *corev1.Pod) {
+				oldPod, found = OldPodFromContext(ctx)
+			}), eiriniManager)
+			Expect(w.InjectDecoder(decoder)).To(Succeed())
+		})
+
+		updateRequest := func(oldName string) admission.Request {
+			req := podRequest(admissionv1beta1.Update)
+			raw, err := json.Marshal(&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: oldName}})
+			Expect(err).ToNot(HaveOccurred())
+			req.OldObject = runtime.RawExtension{Raw: raw}
+			return req
+		}
+
+		It("provides the old pod to the Extension", func() {
+			w.Handle(context.Background(), updateRequest("old"))
+			Expect(found).To(BeTrue())
+			Expect(oldPod.Name).To(Equal("old"))
+		})
+
+		It("doesn't provide an old pod on CREATE", func() {
+			w.Handle(context.Background(), podRequest(admissionv1beta1.Create))
+			Expect(found).To(BeFalse())
+			Expect(oldPod).To(BeNil())
+		})
+
+		It("rejects the request if the old pod can't be decoded", func() {
+			req := podRequest(admissionv1beta1.Update)
+			req.OldObject = runtime.RawExtension{Raw: []byte("{")}
+			res := w.Handle(context.Background(), req)
+			Expect(res.Allowed).To(BeFalse())
+			Expect(res.Result.Code).To(Equal(int32(400)))
+		})
+	})
+
+	Context("When the extension misbehaves", func() {
+		register := func(w MutatingWebhook, policy admissionregistrationv1.FailurePolicyType, timeout time.Duration) {
+			err := w.RegisterAdmissionWebHook(eiriniManager.WebhookServer, WebhookOptions{ID: "volume", ManagerOptions: ManagerOptions{
+				FailurePolicy:       &policy,
+				ExtensionTimeout:    timeout,
+				Namespace:           "eirini",
+				OperatorFingerprint: "eirini-x"}})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(w.InjectDecoder(decoder)).To(Succeed())
+		}
+
+		slowExtension := func() Extension {
+			return extensionFunc(func(ctx context.Context, pod *corev1.Pod) {
+				<-ctx.Done()
+			})
+		}
+
+		It("recovers the panics of the extension", func() {
+			w = NewWebhook(extensionFunc(func(context.Context, *corev1.Pod) {
+				panic("boom")
+			}), eiriniManager)
+			register(w, admissionregistrationv1.Fail, 0)
+
+			res := w.Handle(context.Background(), podRequest(admissionv1beta1.Create))
+			Expect(res.Allowed).To(BeFalse())
+			Expect(res.Result.Code).To(Equal(int32(500)))
+			Expect(res.Result.Message).To(Equal("The volume.eirini-x.org extension panicked: boom"))
+		})
+
+		It("rejects the request when the extension times out with the Fail policy", func() {
+			w = NewWebhook(slowExtension(), eiriniManager)
+			register(w, admissionregistrationv1.Fail, 10*time.Millisecond)
+
+			res := w.Handle(context.Background(), podRequest(admissionv1beta1.Create))
+			Expect(res.Allowed).To(BeFalse())
+			Expect(res.Result.Code).To(Equal(int32(504)))
+		})
+
+		It("allows the request when the extension times out with the Ignore policy", func() {
+			w = NewWebhook(slowExtension(), eiriniManager)
+			register(w, admissionregistrationv1.Ignore, 10*time.Millisecond)
+
+			res := w.Handle(context.Background(), podRequest(admissionv1beta1.Create))
+			Expect(res.Allowed).To(BeTrue())
+			Expect(res.Patches).To(BeEmpty())
+		})
+
+		It("uses the extension timeout of the admission options", func() {
+			timeout := 10 * time.Millisecond
+			failurePolicy := admissionregistrationv1.Fail
+			err := w.RegisterAdmissionWebHook(eiriniManager.WebhookServer, WebhookOptions{ID: "volume",
+				AdmissionOptions: AdmissionOptions{ExtensionTimeout: &timeout},
+				ManagerOptions: ManagerOptions{
+					FailurePolicy:       &failurePolicy,
+					ExtensionTimeout:    time.Minute,
+					Namespace:           "eirini",
+					OperatorFingerprint: "eirini-x"}})
+			Expect(err).ToNot(HaveOccurred())
+
+			mutatingWebHook, ok := w.(*DefaultMutatingWebhook)
+			Expect(ok).To(BeTrue())
+			Expect(mutatingWebHook.ExtensionTimeout).To(Equal(timeout))
+		})
 	})
 })
+
+type extensionFunc func(context.Context, *corev1.Pod)
+
+func (f extensionFunc) Handle(ctx context.Context, m Manager, pod *corev1.Pod, req admission.Request) admission.Response {
+	f(ctx, pod)
+	return admission.Allowed("")
+}